@@ -1,21 +1,21 @@
 package main
 
 import (
-	"bytes"
+	"flag"
 	"fmt"
 	"math/big"
 
 	"github.com/yydfjt/gnark-example/lib/kzg"
 	"github.com/yydfjt/gnark-example/lib/merklecircuit"
-	"github.com/yydfjt/gnark-example/lib/merkletree"
+	"github.com/yydfjt/gnark-example/lib/merkletree/bw6761"
 
 	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bw6-761/fr"
 	"github.com/consensys/gnark-crypto/hash"
 	"github.com/consensys/gnark/backend/witness"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/algebra/native/sw_bls12377"
 	"github.com/consensys/gnark/std/hash/mimc"
-	"github.com/consensys/gnark/std/math/bits"
 )
 
 var curveID = ecc.BW6_761
@@ -23,21 +23,29 @@ var hashID = hash.MIMC_BW6_761
 
 const (
 	InputSize = 2
-	Depth     = 5
 )
 
-var (
-	maxNodes = 1 << Depth
-)
+var depth = flag.Int("depth", 5, "depth of the tree of commitments")
+
+var srsPath = flag.String("srs", "", "file of a ceremony SRS, a throwaway key is generated if empty")
 
 type Circuit struct {
 	MerkleProofs [InputSize]merklecircuit.Circuit
 	Commitments  [InputSize]sw_bls12377.G1Affine
-	Proof        kzg.OpeningProof
+	Proofs       [InputSize]kzg.OpeningProof
 	VerifyKey    kzg.VK            `gnark:",public"`
 	Random       frontend.Variable `gnark:",public"`
 	MerkleRoot   frontend.Variable `gnark:",public"`
 	Max          frontend.Variable `gnark:",public"`
+	Depth        int               `gnark:"-"`
+}
+
+// allocate sizes the Merkle paths for a tree of depth levels.
+func (circuit *Circuit) allocate(depth int) {
+	circuit.Depth = depth
+	for i := range circuit.MerkleProofs {
+		circuit.MerkleProofs[i] = merklecircuit.New(depth)
+	}
 }
 
 func (circuit *Circuit) Define(api frontend.API) error {
@@ -47,18 +55,13 @@ func (circuit *Circuit) Define(api frontend.API) error {
 	}
 
 	api.Println(circuit.MerkleRoot)
-	maxBits := api.ToBinary(circuit.Max, Depth)
 	rnd := frontend.Variable(circuit.Random)
 	for i := 0; i < InputSize; i++ {
 		h.Reset()
 		h.Write(rnd)
 		rnd = h.Sum()
-		rndbit := api.ToBinary(rnd)
-		for j := 0; j < Depth; j++ {
-			rndbit[j] = api.And(rndbit[j], maxBits[j])
-		}
-		d := bits.FromBinary(api, rndbit[:Depth])
-		api.AssertIsEqual(circuit.MerkleProofs[i].Leaf, d)
+		kzg.AssertChunk(api, circuit.MerkleProofs[i].Leaf, rnd, api.Add(circuit.Max, 1))
+		api.AssertIsEqual(circuit.MerkleProofs[i].NumLeaves, api.Add(circuit.Max, 1))
 
 		h.Reset()
 		h.Write(circuit.Commitments[i].X)
@@ -67,18 +70,16 @@ func (circuit *Circuit) Define(api frontend.API) error {
 		api.AssertIsEqual(circuit.MerkleProofs[i].Path[0], h.Sum())
 
 		circuit.MerkleProofs[i].VerifyProof(api, &h, circuit.MerkleRoot)
-		if i != 0 {
-			circuit.Commitments[0].AddAssign(api, circuit.Commitments[i])
-		}
 	}
 
-	kzg.Verify(api, circuit.Commitments[0], circuit.Proof, circuit.Random, circuit.VerifyKey)
+	kzg.BatchVerify(api, circuit.Commitments[:], circuit.Proofs[:], []frontend.Variable{circuit.Random}, circuit.VerifyKey)
 	return nil
 }
 
 func GenWithness() (witness.Witness, error) {
 	var assignment Circuit
-	pk, err := kzg.GenKey()
+	assignment.allocate(*depth)
+	pk, err := kzg.LoadOrGenKey(*srsPath)
 	if err != nil {
 		return nil, err
 	}
@@ -87,12 +88,10 @@ func GenWithness() (witness.Witness, error) {
 	assignment.VerifyKey.G2[0].Assign(&pk.Vk.G2[0])
 	assignment.VerifyKey.G2[1].Assign(&pk.Vk.G2[1])
 
-	mod := curveID.ScalarField()
-	fieldSize := len(mod.Bytes())
-
-	fmt.Printf("node count: %d, field size %d\n", maxNodes, fieldSize)
+	maxNodes := 1 << *depth
+	fmt.Printf("node count: %d, field size %d\n", maxNodes, fr.Bytes)
 
-	comData := make([]byte, 0, maxNodes*fieldSize)
+	leaves := make([]fr.Element, maxNodes)
 	coms := make([]kzg.G1, maxNodes)
 	pfs := make([]kzg.Proof, maxNodes)
 
@@ -104,8 +103,7 @@ func GenWithness() (witness.Witness, error) {
 
 	h := hashID.New()
 
-	var accProof kzg.Proof
-	for i := 0; i < int(maxNodes); i++ {
+	for i := 0; i < maxNodes; i++ {
 		data := kzg.GenRandom(1 * kzg.MaxFileSize)
 		com, err := pk.Commitment(data)
 		if err != nil {
@@ -127,69 +125,58 @@ func GenWithness() (witness.Witness, error) {
 		h.Reset()
 		h.Write(com.X.Marshal())
 		h.Write(com.Y.Marshal())
-
-		comData = append(comData, h.Sum(nil)...)
+		leaves[i].SetBytes(h.Sum(nil))
 	}
 
 	max := new(big.Int).SetUint64(uint64(maxNodes - 1))
 	assignment.Max = new(big.Int).Set(max)
 
-	var accCom kzg.G1
-	rnd := new(big.Int).Set(rndBig)
+	pindices := make([]uint64, InputSize)
+	var rnd fr.Element
+	rnd.SetBigInt(rndBig)
 	for i := 0; i < InputSize; i++ {
 		h.Reset()
-		var rbuf bytes.Buffer
-		rbuf.Write(make([]byte, fieldSize-len(rnd.Bytes())))
-		rbuf.Write(rnd.Bytes())
-		h.Write(rbuf.Bytes())
-		sum := h.Sum(nil)
-		rnd.SetBytes(sum)
+		h.Write(rnd.Marshal())
+		rnd.SetBytes(h.Sum(nil))
 
-		choosed := new(big.Int).And(rnd, max)
-		pindex := choosed.Uint64()
-		fmt.Printf("choose point %d %d \n", i, pindex)
-
-		assignment.Commitments[i].Assign(&coms[pindex])
-		accCom.Add(&accCom, &coms[pindex])
+		pindices[i] = kzg.ReduceChunk(rnd.BigInt(new(big.Int)), uint64(maxNodes))
+		fmt.Printf("choose point %d %d \n", i, pindices[i])
+	}
 
-		accProof.ClaimedValue.Add(&accProof.ClaimedValue, &pfs[pindex].ClaimedValue)
-		accProof.H.Add(&accProof.H, &pfs[pindex].H)
+	merkleProofs, err := bw6761.BuildMultiProof(leaves, pindices)
+	if err != nil {
+		return nil, err
+	}
+	assignment.MerkleRoot = merkleProofs[0].Root
 
-		buf := bytes.NewBuffer(comData)
-		merkleRoot, merkleProof, _, err := merkletree.BuildReaderProof(buf, hashID.New(), fieldSize, pindex)
-		if err != nil {
-			return nil, err
-		}
+	chosenComs := make([]kzg.G1, InputSize)
+	chosenPfs := make([]kzg.Proof, InputSize)
+	for i, pindex := range pindices {
+		chosenComs[i] = coms[pindex]
+		chosenPfs[i] = pfs[pindex]
+		assignment.Commitments[i].Assign(&coms[pindex])
+		assignment.Proofs[i].ClaimedValue = pfs[pindex].ClaimedValue.BigInt(new(big.Int))
+		assignment.Proofs[i].H.Assign(&pfs[pindex].H)
 
-		fmt.Printf("merkle index %d, depth %d leaf %d, root %d\n", pindex, len(merkleProof), len(merkleProof[0]), len(merkleRoot))
+		merkleProof := merkleProofs[i]
+		fmt.Printf("merkle index %d, depth %d\n", pindex, len(merkleProof.Path))
 
-		verified := merkletree.VerifyProof(hashID.New(), merkleRoot, merkleProof, pindex)
+		verified := bw6761.VerifyProof(merkleProof)
 		if !verified {
 			return nil, fmt.Errorf("invalid merkle proof")
 		}
 
-		assignment.MerkleRoot = merkleRoot
-		assignment.MerkleProofs[i].Leaf = pindex
-		for j := 0; j < len(assignment.MerkleProofs[i].Path); j++ {
-			if j < len(merkleProof) {
-				fmt.Println(new(big.Int).SetBytes(merkleProof[j]).String())
-				assignment.MerkleProofs[i].Path[j] = merkleProof[j]
-			} else {
-				assignment.MerkleProofs[i].Path[j] = 0
-			}
+		err = merklecircuit.Assign(&assignment.MerkleProofs[i], merkleProof)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	err = pk.Verify(rndfr, accCom, accProof)
+	err = pk.BatchVerify([]kzg.Fr{rndfr}, chosenComs, chosenPfs)
 	if err != nil {
 		return nil, err
 	}
 
-	claimBig := new(big.Int)
-	accProof.ClaimedValue.BigInt(claimBig)
-	assignment.Proof.ClaimedValue = claimBig
-	assignment.Proof.H.Assign(&accProof.H)
-
 	witness, err := frontend.NewWitness(&assignment, curveID.ScalarField())
 	if err != nil {
 		return nil, err
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 
 	"github.com/consensys/gnark/backend/groth16"
@@ -9,6 +10,8 @@ import (
 )
 
 func main() {
+	flag.Parse()
+
 	witness, err := GenWithness()
 	if err != nil {
 		fmt.Printf("create witness fail: %s\n", err)
@@ -16,7 +19,7 @@ func main() {
 	}
 
 	var circuit Circuit
-	//circuit.allocate()
+	circuit.allocate(*depth)
 	r1cs, err := frontend.Compile(curveID.ScalarField(), r1cs.NewBuilder, &circuit)
 	if err != nil {
 		fmt.Printf("compile fail: %v\n", err)
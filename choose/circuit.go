@@ -3,19 +3,38 @@ package main
 import (
 	"bytes"
 	"crypto/rand"
+	"flag"
 	"fmt"
 	"math/big"
 
 	"github.com/consensys/gnark-crypto/ecc"
-	"github.com/consensys/gnark-crypto/hash"
 	"github.com/consensys/gnark/backend/witness"
 	"github.com/consensys/gnark/constraint/solver"
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/std/hash/mimc"
+	"github.com/yydfjt/gnark-example/lib/merklecircuit"
+	"github.com/yydfjt/gnark-example/lib/merkletree"
 )
 
-var curveID = ecc.BW6_761
-var hashID = hash.MIMC_BW6_761
+var hashName = flag.String("hash", merkletree.HashMiMCBW6761.String(), "hash deriving the challenges, e.g. POSEIDON2_BN254; the curve is the one of its field")
+
+var (
+	curveID ecc.ID
+	hashID  merkletree.HashID
+)
+
+// setHash selects the hash given with -hash and the curve of its field.
+func setHash() error {
+	id, err := merkletree.ParseHashID(*hashName)
+	if err != nil {
+		return err
+	}
+	curve, err := id.Curve()
+	if err != nil {
+		return err
+	}
+	hashID, curveID = id, curve
+	return nil
+}
 
 const (
 	InputSize = 3
@@ -42,7 +61,7 @@ type Circuit struct {
 }
 
 func (circuit *Circuit) Define(api frontend.API) error {
-	h, err := mimc.NewMiMC(api)
+	h, err := merklecircuit.NewHasher(api, hashID)
 	if err != nil {
 		return err
 	}
@@ -72,7 +91,10 @@ func GenWithness() (witness.Witness, error) {
 	mod := curveID.ScalarField()
 	fieldSize := len(mod.Bytes())
 
-	h := hashID.New()
+	h, err := hashID.New()
+	if err != nil {
+		return nil, err
+	}
 
 	rnd, err := rand.Int(rand.Reader, mod)
 	if err != nil {
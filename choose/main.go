@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 
 	"github.com/consensys/gnark/backend/groth16"
@@ -9,6 +10,12 @@ import (
 )
 
 func main() {
+	flag.Parse()
+	if err := setHash(); err != nil {
+		fmt.Printf("%s\n", err)
+		return
+	}
+
 	witness, err := GenWithness()
 	if err != nil {
 		fmt.Printf("create witness fail: %s\n", err)
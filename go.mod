@@ -5,6 +5,7 @@ go 1.20
 require (
 	github.com/consensys/gnark v0.9.2-0.20231106141937-6477e518254b
 	github.com/consensys/gnark-crypto v0.12.2-0.20231117165148-e77308824822
+	golang.org/x/crypto v0.14.0
 )
 
 require (
@@ -23,7 +24,8 @@ require (
 	github.com/rs/zerolog v1.31.0 // indirect
 	github.com/stretchr/testify v1.8.4 // indirect
 	github.com/x448/float16 v0.8.4 // indirect
-	golang.org/x/crypto v0.14.0 // indirect
+	golang.org/x/exp v0.0.0-20230817173708-d852ddb80c63 // indirect
+	golang.org/x/sync v0.3.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	rsc.io/tmplfunc v0.0.3 // indirect
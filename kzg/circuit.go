@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"math/big"
 
 	"github.com/consensys/gnark-crypto/ecc"
@@ -12,6 +13,8 @@ import (
 
 var curveID = ecc.BW6_761
 
+var srsPath = flag.String("srs", "", "file of a ceremony SRS, a throwaway key is generated if empty")
+
 type Circuit struct {
 	Proof      kzg.OpeningProof
 	Commitment sw_bls12377.G1Affine `gnark:",public"`
@@ -25,7 +28,7 @@ func (circuit *Circuit) Define(api frontend.API) error {
 }
 
 func GenWithness() (witness.Witness, error) {
-	pk, err := kzg.GenKey()
+	pk, err := kzg.LoadOrGenKey(*srsPath)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,116 @@
+package kzg
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12377 "github.com/consensys/gnark-crypto/ecc/bls12-377"
+	"github.com/consensys/gnark-crypto/ecc/bls12-377/kzg"
+	bw6fr "github.com/consensys/gnark-crypto/ecc/bw6-761/fr"
+	"github.com/consensys/gnark-crypto/ecc/bw6-761/fr/mimc"
+)
+
+// BatchCoefficientBits is the size of the random coefficients of
+// BatchVerify, which bounds the chance of a bad opening to pass to 2⁻¹²⁸.
+const BatchCoefficientBits = 128
+
+// BatchVerify checks the openings pfs[i] of commits[i] at points[i], or all
+// at points[0] if a single point is given, with one pairing check on a
+// random combination of them. The coefficients rᵢ are derived from a MiMC
+// transcript of the points and openings over BW6-761, so that the
+// BatchVerify gadget recomputes them, and
+//
+//	e(Σ rᵢ(Cᵢ - [yᵢ]G₁ + [zᵢ]Hᵢ), G₂) = e(Σ rᵢHᵢ, [α]G₂).
+//
+// Unlike summing the openings, a bad opening can't be cancelled by another.
+func (pk *PublicKey) BatchVerify(points []Fr, commits []G1, pfs []Proof) error {
+	n := len(commits)
+	if n == 0 || len(pfs) != n || (len(points) != 1 && len(points) != n) {
+		return errors.New("batch sizes don't match")
+	}
+
+	coeffs := batchCoefficients(points, commits, pfs)
+
+	// F = Σ rᵢCᵢ + Σ rᵢzᵢHᵢ - [Σ rᵢyᵢ]G₁
+	bases := make([]G1, 0, 2*n+1)
+	scalars := make([]Fr, 0, 2*n+1)
+	hs := make([]G1, n)
+	var ry, t Fr
+	for i := range commits {
+		z := points[0]
+		if len(points) > 1 {
+			z = points[i]
+		}
+		hs[i] = pfs[i].H
+		bases = append(bases, commits[i], pfs[i].H)
+		scalars = append(scalars, coeffs[i], *t.Mul(&coeffs[i], &z))
+		t.Mul(&coeffs[i], &pfs[i].ClaimedValue)
+		ry.Add(&ry, &t)
+	}
+	bases = append(bases, pk.Vk.G1)
+	scalars = append(scalars, *ry.Neg(&ry))
+
+	var f, w G1
+	if _, err := f.MultiExp(bases, scalars, ecc.MultiExpConfig{}); err != nil {
+		return err
+	}
+	if _, err := w.MultiExp(hs, coeffs, ecc.MultiExpConfig{}); err != nil {
+		return err
+	}
+	w.Neg(&w)
+
+	ok, err := bls12377.PairingCheck(
+		[]G1{f, w},
+		[]G2{pk.Vk.G2[0], pk.Vk.G2[1]},
+	)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return kzg.ErrVerifyOpeningProof
+	}
+	return nil
+}
+
+// batchCoefficients hashes the points, then for each opening the
+// commitment, the quotient and the claimed value, into a challenge γ₀. The
+// coefficient rᵢ is the low BatchCoefficientBits bits of γᵢ, with γᵢ₊₁ the
+// hash of γᵢ.
+func batchCoefficients(points []Fr, commits []G1, pfs []Proof) []Fr {
+	h := mimc.NewMiMC()
+	for i := range points {
+		h.Write(scalarBytes(&points[i]))
+	}
+	for i := range commits {
+		h.Write(commits[i].X.Marshal())
+		h.Write(commits[i].Y.Marshal())
+		h.Write(pfs[i].H.X.Marshal())
+		h.Write(pfs[i].H.Y.Marshal())
+		h.Write(scalarBytes(&pfs[i].ClaimedValue))
+	}
+	gamma := h.Sum(nil)
+
+	mask := new(big.Int).Lsh(big.NewInt(1), BatchCoefficientBits)
+	mask.Sub(mask, big.NewInt(1))
+	coeffs := make([]Fr, len(commits))
+	for i := range coeffs {
+		if i > 0 {
+			h.Reset()
+			h.Write(gamma)
+			gamma = h.Sum(nil)
+		}
+		c := new(big.Int).SetBytes(gamma)
+		coeffs[i].SetBigInt(c.And(c, mask))
+	}
+	return coeffs
+}
+
+// scalarBytes encodes a scalar as an element of the field of BW6-761, which
+// holds it as the scalar field of BLS12-377 is smaller.
+func scalarBytes(s *Fr) []byte {
+	var e bw6fr.Element
+	e.SetBigInt(s.BigInt(new(big.Int)))
+	b := e.Bytes()
+	return b[:]
+}
@@ -1,9 +1,17 @@
 package kzg
 
 import (
+	"math/big"
+
+	bls12377 "github.com/consensys/gnark-crypto/ecc/bls12-377"
+	"github.com/consensys/gnark-crypto/ecc/bls12-377/fr"
+	"github.com/consensys/gnark/constraint/solver"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/algebra/native/fields_bls12377"
 	"github.com/consensys/gnark/std/algebra/native/sw_bls12377"
+	"github.com/consensys/gnark/std/hash/mimc"
+	"github.com/consensys/gnark/std/math/bits"
+	"github.com/consensys/gnark/std/math/emulated"
 )
 
 // Digest commitment of a polynomial.
@@ -53,3 +61,356 @@ func Verify(api frontend.API, commitment Digest, proof OpeningProof, point front
 	resPairing.AssertIsEqual(api, one)
 
 }
+
+// MultiVK verification key for openings at k points: the powers [αʲ]G₁ for
+// j < k and [αʲ]G₂ for j ≤ k. The slices are allocated by NewMultiVK.
+type MultiVK struct {
+	G1 []sw_bls12377.G1Affine
+	G2 []sw_bls12377.G2Affine
+}
+
+// NewMultiVK allocates a key for openings at k points.
+func NewMultiVK(k int) MultiVK {
+	if k <= 0 || k > MaxOpenPoints {
+		panic("invalid number of open points")
+	}
+	return MultiVK{
+		G1: make([]sw_bls12377.G1Affine, k),
+		G2: make([]sw_bls12377.G2Affine, k+1),
+	}
+}
+
+// Assign sets the powers of pk, which must have the G₂ powers.
+func (vk *MultiVK) Assign(pk *PublicKey) {
+	for j := range vk.G1 {
+		vk.G1[j].Assign(&pk.Pk.G1[j])
+	}
+	for j := range vk.G2 {
+		vk.G2[j].Assign(&pk.G2[j])
+	}
+}
+
+// MultiOpeningProof KZG proof for opening at several points.
+type MultiOpeningProof struct {
+	// H quotient polynomial (f - I)/Z
+	H sw_bls12377.G1Affine
+
+	// ClaimedValues purported values
+	ClaimedValues []frontend.Variable
+}
+
+// NewMultiOpeningProof allocates a proof for openings at k points.
+func NewMultiOpeningProof(k int) MultiOpeningProof {
+	return MultiOpeningProof{
+		ClaimedValues: make([]frontend.Variable, k),
+	}
+}
+
+// Assign sets a proof returned by PublicKey.OpenMulti.
+func (p *MultiOpeningProof) Assign(pf *MultiProof) {
+	p.H.Assign(&pf.H)
+	for i := range p.ClaimedValues {
+		p.ClaimedValues[i] = pf.ClaimedValues[i].BigInt(new(big.Int))
+	}
+}
+
+// frParams describes the scalar field of BLS12-377, which is emulated in
+// circuits over BW6-761 as the native field is the base field of BLS12-377.
+type frParams struct{}
+
+func (frParams) NbLimbs() uint     { return 4 }
+func (frParams) BitsPerLimb() uint { return 64 }
+func (frParams) IsPrime() bool     { return true }
+func (frParams) Modulus() *big.Int { return fr.Modulus() }
+
+// newScalarField returns the emulated scalar field with the conversions from
+// a variable holding a scalar and back to one for scalar multiplications.
+func newScalarField(api frontend.API) (
+	f *emulated.Field[frParams],
+	toScalar func(frontend.Variable) *emulated.Element[frParams],
+	fromScalar func(*emulated.Element[frParams]) frontend.Variable,
+) {
+	f, err := emulated.NewField[frParams](api)
+	if err != nil {
+		panic(err)
+	}
+	nbBits := fr.Modulus().BitLen()
+	toScalar = func(v frontend.Variable) *emulated.Element[frParams] {
+		return f.FromBits(api.ToBinary(v, nbBits)...)
+	}
+	fromScalar = func(e *emulated.Element[frParams]) frontend.Variable {
+		return api.FromBinary(f.ToBits(f.Reduce(e))[:nbBits]...)
+	}
+	return f, toScalar, fromScalar
+}
+
+// VerifyMulti verifies a KZG opening proof at several points. The points
+// must be distinct. The coefficients of the vanishing and interpolation
+// polynomials are computed modulo the scalar field, emulated, and may be
+// zero; the commitment and the quotient may be the identity, as for data of
+// at most as many coefficients as points.
+func VerifyMulti(api frontend.API, commitment Digest, proof MultiOpeningProof, points []frontend.Variable, srs MultiVK) {
+	k := len(points)
+	if len(proof.ClaimedValues) != k || len(srs.G1) != k || len(srs.G2) != k+1 {
+		panic("number of open points doesn't match")
+	}
+	f, toScalar, fromScalar := newScalarField(api)
+
+	zs := make([]*emulated.Element[frParams], k)
+	for i := range points {
+		zs[i] = toScalar(points[i])
+	}
+
+	// Z = ∏(x - zᵢ), monic of degree k
+	z := []*emulated.Element[frParams]{f.One()}
+	for i := range zs {
+		z = append(z, f.Zero())
+		for j := len(z) - 1; j >= 0; j-- {
+			t := f.Mul(z[j], zs[i])
+			if j > 0 {
+				z[j] = f.Sub(z[j-1], t)
+			} else {
+				z[j] = f.Neg(t)
+			}
+		}
+	}
+
+	// I = Σ yᵢ/Z'(zᵢ)·Z/(x - zᵢ), the inverse asserting that the points are
+	// distinct
+	interp := make([]*emulated.Element[frParams], k)
+	for j := range interp {
+		interp[j] = f.Zero()
+	}
+	l := make([]*emulated.Element[frParams], k)
+	for i := range zs {
+		l[k-1] = f.One()
+		for j := k - 1; j > 0; j-- {
+			l[j-1] = f.Add(z[j], f.Mul(l[j], zs[i]))
+		}
+		denom := f.One()
+		for j := range zs {
+			if j != i {
+				denom = f.Mul(denom, f.Sub(zs[i], zs[j]))
+			}
+		}
+		scale := f.Mul(toScalar(proof.ClaimedValues[i]), f.Inverse(denom))
+		for j := range l {
+			interp[j] = f.Add(interp[j], f.Mul(l[j], scale))
+		}
+	}
+
+	// [f(α) - I(α)]G₁, the identity when f = I, e.g. for data of at most
+	// k coefficients
+	fMinusI, fMinusIInf := commitment, isInfinity(api, commitment)
+	for j := range interp {
+		t, tInf := scalarMulG1(api, srs.G1[j], 0, fromScalar(interp[j]))
+		t.Neg(api, t)
+		fMinusI, fMinusIInf = addG1(api, fMinusI, fMinusIInf, t, tInf)
+	}
+
+	// [Z(α)]G₂, the leading coefficient being 1. The sum of powers of α
+	// only meets the exceptions of the affine formulas for a negligible
+	// fraction of the keys, but coefficients can be zero.
+	zAlpha := srs.G2[k]
+	for j := 0; j < k; j++ {
+		isZero := api.IsZero(fromScalar(z[j]))
+		var t sw_bls12377.G2Affine
+		t.ScalarMul(api, srs.G2[j], api.Select(isZero, 1, fromScalar(z[j])))
+		t.AddAssign(api, zAlpha)
+		zAlpha.Select(api, isZero, zAlpha, t)
+	}
+
+	// [-H(α)]G₁, the identity for a zero quotient
+	var negH sw_bls12377.G1Affine
+	negH.Neg(api, proof.H)
+	hInf := isInfinity(api, proof.H)
+
+	// f - I and H are both zero or both not, in which case
+	// e([f(α) - I(α)]G₁, G₂).e([-H(α)]G₁, [Z(α)]G₂) ==? 1, otherwise the
+	// trivial e(G₁, G₂).e(-G₁, G₂) is checked
+	api.AssertIsEqual(fMinusIInf, hInf)
+	var g1, negG1 sw_bls12377.G1Affine
+	g1.Assign(&g1Gen)
+	negG1.Neg(api, g1)
+	fMinusI.Select(api, hInf, g1, fMinusI)
+	negH.Select(api, hInf, negG1, negH)
+	zAlpha.Select(api, hInf, srs.G2[0], zAlpha)
+	resPairing, _ := sw_bls12377.Pair(
+		api,
+		[]sw_bls12377.G1Affine{fMinusI, negH},
+		[]sw_bls12377.G2Affine{srs.G2[0], zAlpha},
+	)
+
+	var one fields_bls12377.E12
+	one.SetOne()
+	resPairing.AssertIsEqual(api, one)
+}
+
+// g1Gen is the generator of G₁ standing for the identity, which has no
+// affine coordinates.
+var g1Gen = func() bls12377.G1Affine {
+	_, _, g, _ := bls12377.Generators()
+	return g
+}()
+
+// isInfinity returns 1 if p is the identity, encoded as (0, 0) like in
+// gnark-crypto; the point isn't on the curve.
+func isInfinity(api frontend.API, p sw_bls12377.G1Affine) frontend.Variable {
+	return api.And(api.IsZero(p.X), api.IsZero(p.Y))
+}
+
+// scalarMulG1 returns [s]q and 1 if it is the identity, given whether q is
+// the identity. ScalarMul fails on the identity and on a zero scalar, which
+// are replaced by the generator and 1.
+func scalarMulG1(api frontend.API, q sw_bls12377.G1Affine, qInf, s frontend.Variable) (sw_bls12377.G1Affine, frontend.Variable) {
+	var g1 sw_bls12377.G1Affine
+	g1.Assign(&g1Gen)
+	q.Select(api, qInf, g1, q)
+
+	isZero := api.IsZero(s)
+	var r sw_bls12377.G1Affine
+	r.ScalarMul(api, q, api.Select(isZero, 1, s))
+	return r, api.Or(isZero, qInf)
+}
+
+// addG1 returns p + q and 1 if it is the identity, given whether p and q are
+// the identity. Unlike AddAssign it handles equal and opposite points.
+func addG1(api frontend.API, p sw_bls12377.G1Affine, pInf frontend.Variable, q sw_bls12377.G1Affine, qInf frontend.Variable) (sw_bls12377.G1Affine, frontend.Variable) {
+	sameX := api.IsZero(api.Sub(q.X, p.X))
+	sameY := api.IsZero(api.Sub(q.Y, p.Y))
+	double := api.And(sameX, sameY)
+	opposite := api.And(sameX, api.Sub(1, sameY))
+
+	// λ = (q.y - p.y)/(q.x - p.x), or 3p.x²/2p.y when doubling; a zero
+	// denominator is only left for opposite points or the identity, whose
+	// result is selected away
+	num := api.Select(double, api.Mul(p.X, p.X, 3), api.Sub(q.Y, p.Y))
+	den := api.Select(double, api.Mul(p.Y, 2), api.Sub(q.X, p.X))
+	den = api.Select(api.IsZero(den), 1, den)
+	lambda := api.DivUnchecked(num, den)
+
+	var r sw_bls12377.G1Affine
+	r.X = api.Sub(api.Mul(lambda, lambda), api.Add(p.X, q.X))
+	r.Y = api.Sub(api.Mul(lambda, api.Sub(p.X, r.X)), p.Y)
+
+	r.Select(api, qInf, p, r)
+	r.Select(api, pInf, q, r)
+	inf := api.Select(pInf, qInf, api.Select(qInf, 0, opposite))
+	return r, inf
+}
+
+// BatchVerify verifies the openings proofs[i] of commitments[i] at
+// points[i], or all at points[0] if a single point is given, with the random
+// combination of PublicKey.BatchVerify. The coefficients are recomputed from
+// the MiMC transcript, which requires the circuit to be over BW6-761. The
+// commitments and the quotients may be the identity, as for data of a single
+// shard.
+func BatchVerify(api frontend.API, commitments []Digest, proofs []OpeningProof, points []frontend.Variable, srs VK) {
+	n := len(commitments)
+	if n == 0 || len(proofs) != n || (len(points) != 1 && len(points) != n) {
+		panic("batch sizes don't match")
+	}
+	f, toScalar, fromScalar := newScalarField(api)
+
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		panic(err)
+	}
+	h.Write(points...)
+	for i := range commitments {
+		h.Write(commitments[i].X, commitments[i].Y, proofs[i].H.X, proofs[i].H.Y, proofs[i].ClaimedValue)
+	}
+	gamma := h.Sum()
+
+	// F = Σ rᵢCᵢ + Σ rᵢzᵢHᵢ - [Σ rᵢyᵢ]G₁ and W = Σ rᵢHᵢ, both starting
+	// from the identity
+	var g1 sw_bls12377.G1Affine
+	g1.Assign(&g1Gen)
+	sumF, sumW := g1, g1
+	var fInf, wInf frontend.Variable = 1, 1
+	ry := f.Zero()
+	for i := range commitments {
+		if i > 0 {
+			h.Reset()
+			h.Write(gamma)
+			gamma = h.Sum()
+		}
+		rBits := api.ToBinary(gamma, api.Compiler().FieldBitLen())[:BatchCoefficientBits]
+		r := api.FromBinary(rBits...)
+		rs := f.FromBits(rBits...)
+
+		hInf := isInfinity(api, proofs[i].H)
+		rC, rCInf := scalarMulG1(api, commitments[i], isInfinity(api, commitments[i]), r)
+		rH, rHInf := scalarMulG1(api, proofs[i].H, hInf, r)
+		sumF, fInf = addG1(api, sumF, fInf, rC, rCInf)
+		sumW, wInf = addG1(api, sumW, wInf, rH, rHInf)
+		if len(points) > 1 {
+			rzH, rzHInf := scalarMulG1(api, proofs[i].H, hInf, fromScalar(f.Mul(rs, toScalar(points[i]))))
+			sumF, fInf = addG1(api, sumF, fInf, rzH, rzHInf)
+		}
+		ry = f.Add(ry, f.Mul(rs, toScalar(proofs[i].ClaimedValue)))
+	}
+	if len(points) == 1 {
+		zW, zWInf := scalarMulG1(api, sumW, wInf, points[0])
+		sumF, fInf = addG1(api, sumF, fInf, zW, zWInf)
+	}
+	ryG, ryGInf := scalarMulG1(api, srs.G1, 0, fromScalar(ry))
+	ryG.Neg(api, ryG)
+	sumF, fInf = addG1(api, sumF, fInf, ryG, ryGInf)
+
+	// [-W]G₁
+	sumW.Neg(api, sumW)
+
+	// F and W are both the identity or both not, in which case
+	// e(F, G₂).e(-W, [α]G₂) ==? 1, otherwise the trivial e(G₁, G₂).e(-G₁, G₂)
+	// is checked
+	api.AssertIsEqual(fInf, wInf)
+	var negG1 sw_bls12377.G1Affine
+	negG1.Neg(api, g1)
+	sumF.Select(api, wInf, g1, sumF)
+	sumW.Select(api, wInf, negG1, sumW)
+	alphaG2 := srs.G2[1]
+	alphaG2.Select(api, wInf, srs.G2[0], alphaG2)
+	resPairing, _ := sw_bls12377.Pair(
+		api,
+		[]sw_bls12377.G1Affine{sumF, sumW},
+		[]sw_bls12377.G2Affine{srs.G2[0], alphaG2},
+	)
+
+	var one fields_bls12377.E12
+	one.SetOne()
+	resPairing.AssertIsEqual(api, one)
+}
+
+func init() {
+	solver.RegisterHint(chunkQuotientHint)
+}
+
+// chunkQuotientHint returns the quotient of inputs[0] by inputs[1], or 0 for
+// a zero divisor that AssertChunk rejects anyway.
+func chunkQuotientHint(_ *big.Int, inputs []*big.Int, results []*big.Int) error {
+	if inputs[1].Sign() == 0 {
+		results[0].SetUint64(0)
+		return nil
+	}
+	results[0].Div(inputs[0], inputs[1])
+	return nil
+}
+
+// AssertChunk asserts that chunk is the one drawn by the hash sum among
+// numChunks as in ReduceChunk, that is the low 64 bits of sum are
+// q·numChunks + chunk with chunk < numChunks. numChunks must fit in 64
+// bits, so that both sides are below 2¹²⁸ and the equation holds over the
+// integers.
+func AssertChunk(api frontend.API, chunk, sum, numChunks frontend.Variable) {
+	api.AssertIsDifferent(numChunks, 0)
+	low := bits.FromBinary(api, bits.ToBinary(api, sum)[:64])
+
+	q, err := api.Compiler().NewHint(chunkQuotientHint, 1, low, numChunks)
+	if err != nil {
+		panic(err)
+	}
+	bits.ToBinary(api, q[0], bits.WithNbDigits(64))
+	api.AssertIsLessOrEqual(chunk, api.Sub(numChunks, 1))
+	api.AssertIsEqual(low, api.Add(api.Mul(q[0], numChunks), chunk))
+}
@@ -0,0 +1,218 @@
+package kzg
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+
+	bw6fr "github.com/consensys/gnark-crypto/ecc/bw6-761/fr"
+	"github.com/consensys/gnark-crypto/ecc/bw6-761/fr/mimc"
+	"github.com/yydfjt/gnark-example/lib/merkletree/bw6761"
+)
+
+// Manifest commits to a file of any size. The file is cut into chunks of
+// MaxFileSize bytes, the last one shorter, each chunk is committed to on its
+// own and Root is the Merkle root over BW6-761 of the chunk leaves, as in
+// the acc example.
+type Manifest struct {
+	Size        uint64
+	Commitments []G1
+	Root        bw6fr.Element
+}
+
+// File is a file committed to by CommitFile, kept to answer challenges.
+type File struct {
+	Manifest
+
+	pk     *PublicKey
+	data   []byte
+	leaves []bw6fr.Element
+}
+
+// FileOpening answers a challenge on a file: the chunk drawn by the
+// challenge, its commitment with the Merkle path to the manifest root, and
+// its opening at the challenge. Path can be assigned to merklecircuit.Circuit
+// and Proof to OpeningProof.
+type FileOpening struct {
+	Chunk      uint64
+	Commitment G1
+	Path       bw6761.Proof
+	Proof      Proof
+}
+
+// CommitFile commits to the chunks of d and builds the manifest. d is kept
+// to open the chunks and must not be modified afterwards.
+func (pk *PublicKey) CommitFile(d []byte) (*File, error) {
+	numChunks := 1
+	if len(d) > 0 {
+		numChunks = (len(d) + MaxFileSize - 1) / MaxFileSize
+	}
+	f := &File{
+		Manifest: Manifest{
+			Size:        uint64(len(d)),
+			Commitments: make([]G1, numChunks),
+		},
+		pk:     pk,
+		data:   d,
+		leaves: make([]bw6fr.Element, numChunks),
+	}
+	for i := range f.Commitments {
+		com, err := pk.Commitment(f.chunk(uint64(i)))
+		if err != nil {
+			return nil, err
+		}
+		f.Commitments[i] = com
+		f.leaves[i] = ChunkLeaf(com)
+	}
+
+	root, err := bw6761.Root(f.leaves)
+	if err != nil {
+		return nil, err
+	}
+	f.Root = root
+	return f, nil
+}
+
+// CommitFileReader builds the manifest of the data read from r like
+// CommitFile, streaming each chunk through CommitReader so that the file is
+// never held in memory. The chunks are opened with OpenFileReader.
+func (pk *PublicKey) CommitFileReader(r io.Reader) (*Manifest, error) {
+	br := bufio.NewReader(r)
+	m := new(Manifest)
+	for {
+		lr := &io.LimitedReader{R: br, N: MaxFileSize}
+		com, err := pk.CommitReader(lr)
+		if err != nil {
+			return nil, err
+		}
+		m.Commitments = append(m.Commitments, com)
+		m.Size += uint64(MaxFileSize - lr.N)
+
+		// a full chunk is the last one if nothing follows it
+		if lr.N > 0 {
+			break
+		}
+		if _, err := br.Peek(1); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := bw6761.Root(m.chunkLeaves())
+	if err != nil {
+		return nil, err
+	}
+	m.Root = root
+	return m, nil
+}
+
+// chunkLeaves returns the leaves of the chunk commitments.
+func (m *Manifest) chunkLeaves() []bw6fr.Element {
+	leaves := make([]bw6fr.Element, len(m.Commitments))
+	for i := range leaves {
+		leaves[i] = ChunkLeaf(m.Commitments[i])
+	}
+	return leaves
+}
+
+// NumChunks returns the number of chunks of the file.
+func (m *Manifest) NumChunks() uint64 {
+	return uint64(len(m.Commitments))
+}
+
+// chunk returns the data of the i-th chunk.
+func (f *File) chunk(i uint64) []byte {
+	end := (i + 1) * MaxFileSize
+	if end > f.Size {
+		end = f.Size
+	}
+	return f.data[i*MaxFileSize : end]
+}
+
+// OpenFile opens the chunk drawn by challenge at the challenge.
+func (f *File) OpenFile(challenge Fr) (*FileOpening, error) {
+	i := ChunkIndex(challenge, f.NumChunks())
+	pf, err := f.pk.Open(challenge, f.chunk(i))
+	if err != nil {
+		return nil, err
+	}
+	return f.opening(f.leaves, i, pf)
+}
+
+// OpenFileReader opens the chunk drawn by challenge at the challenge, like
+// OpenFile for a manifest built by CommitFileReader. Only the drawn chunk is
+// read from r, through OpenReader.
+func (pk *PublicKey) OpenFileReader(m *Manifest, r io.ReaderAt, challenge Fr) (*FileOpening, error) {
+	i := ChunkIndex(challenge, m.NumChunks())
+	size := m.Size - i*MaxFileSize
+	if size > MaxFileSize {
+		size = MaxFileSize
+	}
+	pf, err := pk.OpenReader(io.NewSectionReader(r, int64(i*MaxFileSize), int64(size)), challenge)
+	if err != nil {
+		return nil, err
+	}
+	return m.opening(m.chunkLeaves(), i, pf)
+}
+
+// opening returns the opening pf of the i-th chunk with its path.
+func (m *Manifest) opening(leaves []bw6fr.Element, i uint64, pf Proof) (*FileOpening, error) {
+	path, err := bw6761.BuildProof(leaves, i)
+	if err != nil {
+		return nil, err
+	}
+	return &FileOpening{
+		Chunk:      i,
+		Commitment: m.Commitments[i],
+		Path:       path,
+		Proof:      pf,
+	}, nil
+}
+
+// VerifyFile checks that op answers challenge on the file of numChunks
+// chunks with the manifest root.
+func (pk *PublicKey) VerifyFile(root bw6fr.Element, numChunks uint64, challenge Fr, op *FileOpening) error {
+	if op.Chunk != ChunkIndex(challenge, numChunks) {
+		return errors.New("chunk not drawn by the challenge")
+	}
+	leaf := ChunkLeaf(op.Commitment)
+	if op.Path.Index != op.Chunk || op.Path.NumLeaves != numChunks || !op.Path.Root.Equal(&root) ||
+		len(op.Path.Path) == 0 || !op.Path.Path[0].Equal(&leaf) || !bw6761.VerifyProof(op.Path) {
+		return errors.New("invalid chunk path")
+	}
+	return pk.Verify(challenge, op.Commitment, op.Proof)
+}
+
+// ChunkLeaf returns the leaf of a chunk commitment in the manifest, the MiMC
+// of its coordinates.
+func ChunkLeaf(com G1) bw6fr.Element {
+	h := mimc.NewMiMC()
+	h.Write(com.X.Marshal())
+	h.Write(com.Y.Marshal())
+	var leaf bw6fr.Element
+	leaf.SetBytes(h.Sum(nil))
+	return leaf
+}
+
+// ChunkIndex returns the chunk drawn by challenge among numChunks, the MiMC
+// of the challenge reduced by ReduceChunk.
+func ChunkIndex(challenge Fr, numChunks uint64) uint64 {
+	h := mimc.NewMiMC()
+	h.Write(scalarBytes(&challenge))
+	return ReduceChunk(new(big.Int).SetBytes(h.Sum(nil)), numChunks)
+}
+
+// ReduceChunk returns the chunk drawn by a hash sum among numChunks, the low
+// 64 bits of sum modulo numChunks. Every chunk is drawn for any number of
+// chunks, with a bias of at most numChunks/2⁶⁴. AssertChunk is the circuit
+// counterpart, used by the acc circuit to draw its chunks.
+func ReduceChunk(sum *big.Int, numChunks uint64) uint64 {
+	if numChunks == 0 {
+		panic("no chunk to draw")
+	}
+	low := new(big.Int).And(sum, new(big.Int).SetUint64(math.MaxUint64))
+	return low.Uint64() % numChunks
+}
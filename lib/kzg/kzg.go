@@ -11,8 +11,9 @@ import (
 
 const (
 	ShardingLen = 31
+	HeaderLen   = 8 // length of the data at the start of the first shard
 	MaxShards   = 1024
-	MaxFileSize = MaxShards * ShardingLen
+	MaxFileSize = MaxShards*ShardingLen - HeaderLen
 )
 
 type G1 = bls12377.G1Affine
@@ -35,17 +36,38 @@ type VerifyingKey struct {
 
 type PublicKey struct {
 	*kzg.SRS
+
+	// G2 holds [αʲ]G₂ for j ≤ MaxOpenPoints, needed to verify openings at
+	// several points. It is nil for SRS files that don't provide it.
+	G2 []G2
 }
 
+// GenKey returns a key of SRSSize powers of a random α that is forgotten
+// afterwards. Its openings can't be forged, but as nobody else can check
+// that α was discarded, it is only fit for tests and examples. Other keys
+// are loaded with LoadKey from the output of a ceremony.
 func GenKey() (*PublicKey, error) {
-	alpha := big.NewInt(12345678)
-	kzgSRS, err := kzg.NewSRS(uint64(MaxShards*4), alpha)
+	var alpha Fr
+	if _, err := alpha.SetRandom(); err != nil {
+		return nil, err
+	}
+	kzgSRS, err := kzg.NewSRS(SRSSize, alpha.BigInt(new(big.Int)))
 	if err != nil {
 		return nil, err
 	}
 
+	g2 := make([]G2, MaxOpenPoints+1)
+	g2[0] = kzgSRS.Vk.G2[0]
+	var power Fr
+	power.SetOne()
+	for j := 1; j < len(g2); j++ {
+		power.Mul(&power, &alpha)
+		g2[j].ScalarMultiplication(&g2[0], power.BigInt(new(big.Int)))
+	}
+
 	return &PublicKey{
 		SRS: kzgSRS,
+		G2:  g2,
 	}, nil
 }
 
@@ -65,6 +87,10 @@ func (pk *PublicKey) Open(rnd Fr, d []byte) (Proof, error) {
 	}
 
 	shards := Split(d)
+	if len(shards) == 1 {
+		// a constant has a zero quotient, which kzg.Open can't commit to
+		return Proof{ClaimedValue: shards[0]}, nil
+	}
 	return kzg.Open(shards, rnd, pk.SRS.Pk)
 }
 
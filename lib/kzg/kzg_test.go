@@ -1,7 +1,15 @@
 package kzg
 
 import (
+	"bytes"
+	"math/big"
 	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bls12-377/kzg"
+	bw6fr "github.com/consensys/gnark-crypto/ecc/bw6-761/fr"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
 )
 
 func TestKZG(t *testing.T) {
@@ -37,35 +45,588 @@ func TestMultiKZG(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	const n = 3
+	var rnd Fr
+	rnd.SetRandom()
+	points := make([]Fr, n)
+	for i := range points {
+		points[i].SetRandom()
+	}
+
+	for _, shared := range []bool{true, false} {
+		coms := make([]G1, n)
+		pfs := make([]Proof, n)
+		for i := range coms {
+			data := GenRandom(1 * MaxFileSize)
+			z := rnd
+			if !shared {
+				z = points[i]
+			}
+
+			coms[i], err = pk.Commitment(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pfs[i], err = pk.Open(z, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		batchPoints := []Fr{rnd}
+		if !shared {
+			batchPoints = points
+		}
+		if err := pk.BatchVerify(batchPoints, coms, pfs); err != nil {
+			t.Fatal(err)
+		}
+
+		// two wrong values cancelling in the sum are caught
+		var delta Fr
+		delta.SetRandom()
+		pfs[0].ClaimedValue.Add(&pfs[0].ClaimedValue, &delta)
+		pfs[1].ClaimedValue.Sub(&pfs[1].ClaimedValue, &delta)
+		if err := pk.BatchVerify(batchPoints, coms, pfs); err == nil {
+			t.Fatal("cancelling openings accepted")
+		}
+		if shared {
+			var accCom G1
+			var accProof Proof
+			for i := range coms {
+				accCom.Add(&accCom, &coms[i])
+				accProof.ClaimedValue.Add(&accProof.ClaimedValue, &pfs[i].ClaimedValue)
+				accProof.H.Add(&accProof.H, &pfs[i].H)
+			}
+			if err := pk.Verify(rnd, accCom, accProof); err != nil {
+				t.Fatal("plain sum should accept the cancelling openings: ", err)
+			}
+		}
+	}
+}
+
+func TestSRS(t *testing.T) {
+	alpha := big.NewInt(987654321)
+	srs, err := kzg.NewSRS(SRSSize+7, alpha)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := (&PublicKey{SRS: srs}).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var pk PublicKey
+	if _, err := pk.ReadFrom(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if len(pk.Pk.G1) != SRSSize {
+		t.Fatal("srs not trimmed: ", len(pk.Pk.G1))
+	}
+
+	// the key written and read back opens and verifies
+	buf.Reset()
+	if _, err := pk.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var loaded PublicKey
+	if _, err := loaded.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := GenRandom(MaxFileSize)
+	com, err := pk.Commitment(data)
+	if err != nil {
+		t.Fatal(err)
+	}
 	var rnd Fr
 	rnd.SetRandom()
+	pf, err := pk.Open(rnd, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Verify(rnd, com, pf); err != nil {
+		t.Fatal(err)
+	}
+
+	// a power of another α is rejected
+	bad := *srs
+	bad.Pk.G1 = append([]G1(nil), srs.Pk.G1...)
+	bad.Pk.G1[SRSSize/2].Add(&bad.Pk.G1[SRSSize/2], &bad.Pk.G1[0])
+	buf.Reset()
+	bad.WriteTo(&buf)
+	if _, err := pk.ReadFrom(&buf); err != errSRSInvalid {
+		t.Fatal("inconsistent srs accepted: ", err)
+	}
+
+	// the powers of G₂ of a generated key are kept
+	gen, err := GenKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if _, err := gen.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loaded.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.G2) != MaxOpenPoints+1 || !loaded.G2[MaxOpenPoints].Equal(&gen.G2[MaxOpenPoints]) {
+		t.Fatal("powers of G₂ not read back")
+	}
+
+	short, _ := kzg.NewSRS(SRSSize-1, alpha)
+	buf.Reset()
+	short.WriteTo(&buf)
+	if _, err := pk.ReadFrom(&buf); err != errSRSSize {
+		t.Fatal("short srs accepted: ", err)
+	}
+}
+
+func TestMultiOpen(t *testing.T) {
+	pk, err := GenKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{MaxFileSize, 3 * ShardingLen} {
+		data := GenRandom(size)
+		com, err := pk.Commitment(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, k := range []int{1, 5, MaxOpenPoints} {
+			points := make([]Fr, k)
+			for i := range points {
+				points[i].SetRandom()
+			}
+			pf, err := pk.OpenMulti(points, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := pk.VerifyMulti(points, com, pf); err != nil {
+				t.Fatal(size, k, err)
+			}
+
+			// the values agree with single openings
+			single, err := pk.Open(points[k-1], data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !single.ClaimedValue.Equal(&pf.ClaimedValues[k-1]) {
+				t.Fatal("claimed value differs from a single opening")
+			}
+
+			pf.ClaimedValues[0].SetRandom()
+			if err := pk.VerifyMulti(points, com, pf); err == nil {
+				t.Fatal("wrong value accepted")
+			}
+		}
+	}
+
+	points := make([]Fr, 2)
+	points[0].SetRandom()
+	points[1] = points[0]
+	if _, err := pk.OpenMulti(points, GenRandom(MaxFileSize)); err != errOpenPoints {
+		t.Fatal("repeated point accepted: ", err)
+	}
+}
 
-	var accCom G1
-	var accProof Proof
-	for i := 0; i < 2; i++ {
-		data := GenRandom(1 * MaxFileSize)
+type multiCircuit struct {
+	Proof      MultiOpeningProof
+	Commitment Digest
+	Points     []frontend.Variable
+	VerifyKey  MultiVK
+}
+
+func (c *multiCircuit) Define(api frontend.API) error {
+	VerifyMulti(api, c.Commitment, c.Proof, c.Points, c.VerifyKey)
+	return nil
+}
+
+func newMultiCircuit(k int) multiCircuit {
+	return multiCircuit{
+		Proof:     NewMultiOpeningProof(k),
+		Points:    make([]frontend.Variable, k),
+		VerifyKey: NewMultiVK(k),
+	}
+}
 
+func TestVerifyMultiCircuit(t *testing.T) {
+	const k = 2
+	pk, err := GenKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// data of at most k coefficients has a zero quotient, and of a single
+	// one a zero coefficient of degree 1 in I; opposite points leave a zero
+	// coefficient of degree 1 in Z
+	for _, c := range []struct {
+		size     int
+		opposite bool
+	}{{10, false}, {40, false}, {MaxFileSize, false}, {MaxFileSize, true}} {
+		data := GenRandom(c.size)
 		com, err := pk.Commitment(data)
 		if err != nil {
 			t.Fatal(err)
 		}
+		points := make([]Fr, k)
+		for i := range points {
+			points[i].SetRandom()
+		}
+		if c.opposite {
+			points[1].Neg(&points[0])
+		}
+		pf, err := pk.OpenMulti(points, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assignment := newMultiCircuit(k)
+		assignment.Proof.Assign(&pf)
+		assignment.Commitment.Assign(&com)
+		for i := range points {
+			assignment.Points[i] = points[i].BigInt(new(big.Int))
+		}
+		assignment.VerifyKey.Assign(pk)
+		circuit := newMultiCircuit(k)
+		if err := test.IsSolved(&circuit, &assignment, ecc.BW6_761.ScalarField()); err != nil {
+			t.Fatal(c.size, c.opposite, err)
+		}
+
+		var wrong Fr
+		wrong.SetRandom()
+		assignment.Proof.ClaimedValues[1] = wrong.BigInt(new(big.Int))
+		if err := test.IsSolved(&circuit, &assignment, ecc.BW6_761.ScalarField()); err == nil {
+			t.Fatal(c.size, c.opposite, "wrong value accepted")
+		}
+	}
+}
+
+type batchCircuit struct {
+	Proofs      []OpeningProof
+	Commitments []Digest
+	Points      []frontend.Variable
+	VerifyKey   VK
+}
+
+func (c *batchCircuit) Define(api frontend.API) error {
+	BatchVerify(api, c.Commitments, c.Proofs, c.Points, c.VerifyKey)
+	return nil
+}
+
+func newBatchCircuit(n, nbPoints int) batchCircuit {
+	return batchCircuit{
+		Proofs:      make([]OpeningProof, n),
+		Commitments: make([]Digest, n),
+		Points:      make([]frontend.Variable, nbPoints),
+	}
+}
+
+func TestBatchVerifyCircuit(t *testing.T) {
+	pk, err := GenKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// data of a single shard is opened with an identity quotient
+	batches := [][]int{
+		{MaxFileSize, MaxFileSize},
+		{MaxFileSize, 10, MaxFileSize},
+		{10, 10},
+	}
+	for _, sizes := range batches {
+		n := len(sizes)
+		for _, nbPoints := range []int{1, n} {
+			testBatchVerifyCircuit(t, pk, sizes, nbPoints)
+		}
+	}
+}
+
+func testBatchVerifyCircuit(t *testing.T, pk *PublicKey, sizes []int, nbPoints int) {
+	n := len(sizes)
+	points := make([]Fr, nbPoints)
+	for i := range points {
+		points[i].SetRandom()
+	}
+	coms := make([]G1, n)
+	pfs := make([]Proof, n)
+	var err error
+	for i := range coms {
+		data := GenRandom(sizes[i])
+		if coms[i], err = pk.Commitment(data); err != nil {
+			t.Fatal(err)
+		}
+		if pfs[i], err = pk.Open(points[i%nbPoints], data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assignment := newBatchCircuit(n, nbPoints)
+	for i := range coms {
+		assignment.Commitments[i].Assign(&coms[i])
+		assignment.Proofs[i].H.Assign(&pfs[i].H)
+		assignment.Proofs[i].ClaimedValue = pfs[i].ClaimedValue.BigInt(new(big.Int))
+	}
+	for i := range points {
+		assignment.Points[i] = points[i].BigInt(new(big.Int))
+	}
+	assignment.VerifyKey.G1.Assign(&pk.Vk.G1)
+	assignment.VerifyKey.G2[0].Assign(&pk.Vk.G2[0])
+	assignment.VerifyKey.G2[1].Assign(&pk.Vk.G2[1])
+	circuit := newBatchCircuit(n, nbPoints)
+	if err := test.IsSolved(&circuit, &assignment, ecc.BW6_761.ScalarField()); err != nil {
+		t.Fatal(sizes, nbPoints, err)
+	}
+
+	var delta Fr
+	delta.SetRandom()
+	pfs[0].ClaimedValue.Add(&pfs[0].ClaimedValue, &delta)
+	pfs[1].ClaimedValue.Sub(&pfs[1].ClaimedValue, &delta)
+	assignment.Proofs[0].ClaimedValue = pfs[0].ClaimedValue.BigInt(new(big.Int))
+	assignment.Proofs[1].ClaimedValue = pfs[1].ClaimedValue.BigInt(new(big.Int))
+	if err := test.IsSolved(&circuit, &assignment, ecc.BW6_761.ScalarField()); err == nil {
+		t.Fatal(sizes, nbPoints, "cancelling openings accepted")
+	}
+}
+
+func TestSplitJoin(t *testing.T) {
+	for _, size := range []int{0, 1, ShardingLen - HeaderLen, ShardingLen - HeaderLen + 1, 100, MaxFileSize} {
+		data := GenRandom(size)
+		if size > 0 {
+			data[size-1] = 0 // trailing zeros are kept
+		}
+		shards := Split(data)
+		if len(shards) != (HeaderLen+size+ShardingLen-1)/ShardingLen {
+			t.Fatal("unexpected number of shards: ", size, len(shards))
+		}
+		res, err := Join(shards)
+		if err != nil {
+			t.Fatal(size, err)
+		}
+		if !bytes.Equal(res, data) {
+			t.Fatal("data not recovered: ", size)
+		}
+	}
+	if len(Split(GenRandom(MaxFileSize))) != MaxShards {
+		t.Fatal("MaxFileSize doesn't fill MaxShards shards")
+	}
+
+	shards := Split(GenRandom(40))
+	var one Fr
+	one.SetOne()
+	if _, err := Join(append(shards, Fr{})); err == nil {
+		t.Fatal("extra shard accepted")
+	}
+	bad := append([]Fr(nil), shards...)
+	bad[len(bad)-1].Add(&bad[len(bad)-1], &one)
+	if _, err := Join(bad); err == nil {
+		t.Fatal("non-zero padding accepted")
+	}
+	bad[len(bad)-1].SetBigInt(new(big.Int).Lsh(big.NewInt(1), 8*ShardingLen))
+	if _, err := Join(bad); err == nil {
+		t.Fatal("oversized shard accepted")
+	}
+	if _, err := Join(nil); err == nil {
+		t.Fatal("empty blob accepted")
+	}
+}
+
+func FuzzSplitJoin(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0})
+	f.Add(GenRandom(3*ShardingLen - HeaderLen))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		res, err := Join(Split(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(res, data) {
+			t.Fatal("data not recovered")
+		}
+	})
+}
+
+// FuzzJoin decodes arbitrary shards, which must re-encode to themselves
+// whenever they are accepted.
+func FuzzJoin(f *testing.F) {
+	seed := make([]byte, 0, 2*32)
+	for _, s := range Split(GenRandom(40)) {
+		b := s.Bytes()
+		seed = append(seed, b[:]...)
+	}
+	f.Add(seed)
+	f.Add(make([]byte, 32))
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		shards := make([]Fr, len(raw)/32)
+		for i := range shards {
+			shards[i].SetBytes(raw[32*i : 32*(i+1)])
+		}
+		data, err := Join(shards)
+		if err != nil {
+			return
+		}
+		again := Split(data)
+		if len(again) != len(shards) {
+			t.Fatal("shards not canonical")
+		}
+		for i := range again {
+			if !again[i].Equal(&shards[i]) {
+				t.Fatal("shards not canonical")
+			}
+		}
+	})
+}
+
+func TestFile(t *testing.T) {
+	pk, err := GenKey()
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		pf, err := pk.Open(rnd, data)
+	for _, size := range []int{0, 100, 2 * MaxFileSize, 2*MaxFileSize + 1, 3*MaxFileSize + 5, 4*MaxFileSize + 1} {
+		data := GenRandom(size)
+		f, err := pk.CommitFile(data)
 		if err != nil {
 			t.Fatal(err)
 		}
+		// an empty file has an empty chunk
+		want := (size + MaxFileSize - 1) / MaxFileSize
+		if want == 0 {
+			want = 1
+		}
+		numChunks := f.NumChunks()
+		if numChunks != uint64(want) {
+			t.Fatal("unexpected number of chunks: ", size, numChunks)
+		}
 
-		err = pk.Verify(rnd, com, pf)
+		// the manifest streamed from a reader is the same
+		m, err := pk.CommitFileReader(bytes.NewReader(data))
 		if err != nil {
 			t.Fatal(err)
 		}
-		accCom.Add(&accCom, &com)
-		accProof.ClaimedValue.Add(&accProof.ClaimedValue, &pf.ClaimedValue)
-		accProof.H.Add(&accProof.H, &pf.H)
+		if m.Size != f.Size || m.NumChunks() != numChunks || !m.Root.Equal(&f.Root) {
+			t.Fatal("streamed manifest differs: ", size)
+		}
+
+		for j := 0; j < 4; j++ {
+			var challenge Fr
+			challenge.SetRandom()
+			op, err := f.OpenFile(challenge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := pk.VerifyFile(f.Root, numChunks, challenge, op); err != nil {
+				t.Fatal(size, err)
+			}
+			sop, err := pk.OpenFileReader(m, bytes.NewReader(data), challenge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sop.Chunk != op.Chunk || !sop.Proof.H.Equal(&op.Proof.H) || !sop.Proof.ClaimedValue.Equal(&op.Proof.ClaimedValue) {
+				t.Fatal("streamed opening differs: ", size)
+			}
+
+			if numChunks > 1 {
+				moved := *op
+				moved.Chunk = (op.Chunk + 1) % numChunks
+				if err := pk.VerifyFile(f.Root, numChunks, challenge, &moved); err == nil {
+					t.Fatal("chunk not drawn by the challenge accepted")
+				}
+			}
+			var one Fr
+			one.SetOne()
+			op.Proof.ClaimedValue.Add(&op.Proof.ClaimedValue, &one)
+			if err := pk.VerifyFile(f.Root, numChunks, challenge, op); err == nil {
+				t.Fatal("wrong value accepted")
+			}
+		}
+	}
+}
+
+type chunkCircuit struct {
+	Chunk     frontend.Variable
+	Sum       frontend.Variable
+	NumChunks frontend.Variable
+}
+
+func (c *chunkCircuit) Define(api frontend.API) error {
+	AssertChunk(api, c.Chunk, c.Sum, c.NumChunks)
+	return nil
+}
+
+func TestChunkIndex(t *testing.T) {
+	// numbers of chunks that aren't powers of two draw every chunk
+	for _, numChunks := range []uint64{3, 5} {
+		drawn := make(map[uint64]bool)
+		for j := 0; j < 200; j++ {
+			var challenge Fr
+			challenge.SetRandom()
+			i := ChunkIndex(challenge, numChunks)
+			if i >= numChunks {
+				t.Fatal("chunk out of range: ", numChunks, i)
+			}
+			drawn[i] = true
+		}
+		if uint64(len(drawn)) != numChunks {
+			t.Fatal("chunks not drawn: ", numChunks, drawn)
+		}
+
+		var sum bw6fr.Element
+		sum.SetRandom()
+		sumBig := sum.BigInt(new(big.Int))
+		i := ReduceChunk(sumBig, numChunks)
+		check := func(chunk uint64, ok bool) {
+			assignment := chunkCircuit{Chunk: chunk, Sum: sumBig, NumChunks: numChunks}
+			err := test.IsSolved(&chunkCircuit{}, &assignment, ecc.BW6_761.ScalarField())
+			if (err == nil) != ok {
+				t.Fatal(numChunks, chunk, err)
+			}
+		}
+		check(i, true)
+		check((i+1)%numChunks, false)
+		check(i+numChunks, false)
 	}
+}
 
-	err = pk.Verify(rnd, accCom, accProof)
+func TestReader(t *testing.T) {
+	pk, err := GenKey()
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	sizes := []int{0, 1, ShardingLen - HeaderLen, ShardingLen, readWindow*ShardingLen + 3, MaxFileSize}
+	for _, size := range sizes {
+		data := GenRandom(size)
+		com, err := pk.Commitment(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		streamed, err := pk.CommitReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !streamed.Equal(&com) {
+			t.Fatal("streamed commitment differs: ", size)
+		}
+
+		var rnd Fr
+		rnd.SetRandom()
+		for _, z := range []Fr{rnd, {}} {
+			pf, err := pk.Open(z, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			spf, err := pk.OpenReader(bytes.NewReader(data), z)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !spf.H.Equal(&pf.H) || !spf.ClaimedValue.Equal(&pf.ClaimedValue) {
+				t.Fatal("streamed opening differs: ", size, z.IsZero())
+			}
+		}
+	}
+
+	if _, err := pk.CommitReader(bytes.NewReader(GenRandom(MaxFileSize + 1))); err == nil {
+		t.Fatal("oversized data accepted")
+	}
 }
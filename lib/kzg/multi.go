@@ -0,0 +1,184 @@
+package kzg
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12377 "github.com/consensys/gnark-crypto/ecc/bls12-377"
+	"github.com/consensys/gnark-crypto/ecc/bls12-377/kzg"
+)
+
+// MaxOpenPoints is the largest number of points opened by a single
+// MultiProof, bounded by the powers of G₂ kept in a PublicKey.
+const MaxOpenPoints = 16
+
+var errOpenPoints = errors.New("open points must be distinct and at most MaxOpenPoints")
+
+// MultiProof opens a commitment to f at the points z₀…zₖ₋₁. With the
+// vanishing polynomial Z = ∏(x - zᵢ) and the polynomial I of degree < k
+// interpolating the claimed values, H commits to the quotient (f - I)/Z.
+type MultiProof struct {
+	// H commitment to the quotient (f - I)/Z
+	H G1
+
+	// ClaimedValues purported values f(zᵢ)
+	ClaimedValues []Fr
+}
+
+// OpenMulti opens the commitment to d at the given distinct points with a
+// single quotient.
+func (pk *PublicKey) OpenMulti(points []Fr, d []byte) (MultiProof, error) {
+	if len(d) > MaxFileSize {
+		return MultiProof{}, fmt.Errorf("data size too large")
+	}
+	if err := checkPoints(points); err != nil {
+		return MultiProof{}, err
+	}
+
+	// divide f by the monic Z, leaving the remainder I in the low
+	// coefficients of rem
+	z := vanishing(points)
+	k := len(points)
+	rem := Split(d)
+	var pf MultiProof
+	if len(rem) > k {
+		quotient := make([]Fr, len(rem)-k)
+		var t Fr
+		for i := len(rem) - 1; i >= k; i-- {
+			quotient[i-k] = rem[i]
+			for j := 0; j < k; j++ {
+				t.Mul(&quotient[i-k], &z[j])
+				rem[i-k+j].Sub(&rem[i-k+j], &t)
+			}
+		}
+		var err error
+		if pf.H, err = kzg.Commit(quotient, pk.SRS.Pk); err != nil {
+			return MultiProof{}, err
+		}
+		rem = rem[:k]
+	}
+
+	pf.ClaimedValues = make([]Fr, k)
+	for i := range points {
+		pf.ClaimedValues[i] = eval(rem, points[i])
+	}
+	return pf, nil
+}
+
+// VerifyMulti checks that pf opens commit at the given points, that is
+// e(C - [I(α)]G₁, G₂) = e(H, [Z(α)]G₂).
+func (pk *PublicKey) VerifyMulti(points []Fr, commit G1, pf MultiProof) error {
+	if err := checkPoints(points); err != nil {
+		return err
+	}
+	k := len(points)
+	if len(pf.ClaimedValues) != k {
+		return errors.New("claimed values don't match the points")
+	}
+	if len(pk.G2) <= k {
+		return errors.New("key has too few powers of G₂")
+	}
+
+	var iAlpha G1
+	if _, err := iAlpha.MultiExp(pk.Pk.G1[:k], interpolate(points, pf.ClaimedValues), ecc.MultiExpConfig{}); err != nil {
+		return err
+	}
+	var zAlpha G2
+	if _, err := zAlpha.MultiExp(pk.G2[:k+1], vanishing(points), ecc.MultiExpConfig{}); err != nil {
+		return err
+	}
+
+	var fMinusI, negH G1
+	fMinusI.Sub(&commit, &iAlpha)
+	negH.Neg(&pf.H)
+	ok, err := bls12377.PairingCheck(
+		[]G1{fMinusI, negH},
+		[]G2{pk.G2[0], zAlpha},
+	)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return kzg.ErrVerifyOpeningProof
+	}
+	return nil
+}
+
+// checkPoints returns an error unless there are 1 to MaxOpenPoints distinct
+// points.
+func checkPoints(points []Fr) error {
+	if len(points) == 0 || len(points) > MaxOpenPoints {
+		return errOpenPoints
+	}
+	for i := range points {
+		for j := 0; j < i; j++ {
+			if points[i].Equal(&points[j]) {
+				return errOpenPoints
+			}
+		}
+	}
+	return nil
+}
+
+// vanishing returns the coefficients of ∏(x - zᵢ), from the constant one up.
+func vanishing(points []Fr) []Fr {
+	z := make([]Fr, 1, len(points)+1)
+	z[0].SetOne()
+	var t Fr
+	for i := range points {
+		z = append(z, Fr{})
+		for j := len(z) - 1; j >= 0; j-- {
+			// z = z·x - zᵢ·z
+			t.Mul(&z[j], &points[i])
+			if j > 0 {
+				z[j].Sub(&z[j-1], &t)
+			} else {
+				z[j].Neg(&t)
+			}
+		}
+	}
+	return z
+}
+
+// interpolate returns the coefficients of the polynomial of degree < k
+// taking values[i] at the k distinct points[i], as the sum of the Lagrange
+// polynomials Z/(x - zᵢ) scaled by values[i]/Z'(zᵢ).
+func interpolate(points, values []Fr) []Fr {
+	k := len(points)
+	z := vanishing(points)
+	res := make([]Fr, k)
+	l := make([]Fr, k)
+	var scale, t Fr
+	for i := range points {
+		// synthetic division of Z by x - zᵢ
+		l[k-1].SetOne()
+		for j := k - 1; j > 0; j-- {
+			t.Mul(&l[j], &points[i])
+			l[j-1].Add(&z[j], &t)
+		}
+
+		scale.SetOne()
+		for j := range points {
+			if j != i {
+				t.Sub(&points[i], &points[j])
+				scale.Mul(&scale, &t)
+			}
+		}
+		scale.Inverse(&scale).Mul(&scale, &values[i])
+		for j := range l {
+			t.Mul(&l[j], &scale)
+			res[j].Add(&res[j], &t)
+		}
+	}
+	return res
+}
+
+// eval returns p(x) by Horner's rule.
+func eval(p []Fr, x Fr) Fr {
+	var res Fr
+	for i := len(p) - 1; i >= 0; i-- {
+		res.Mul(&res, &x).Add(&res, &p[i])
+	}
+	return res
+}
@@ -0,0 +1,184 @@
+package kzg
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12377 "github.com/consensys/gnark-crypto/ecc/bls12-377"
+	"github.com/consensys/gnark-crypto/ecc/bls12-377/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-377/kzg"
+)
+
+// SRSSize is the number of powers of α kept in a PublicKey, enough to commit
+// to MaxShards shards.
+const SRSSize = MaxShards
+
+var (
+	errSRSSize    = errors.New("srs has too few powers")
+	errSRSInvalid = errors.New("srs powers are inconsistent")
+)
+
+// WriteTo writes the SRS in the encoding of gnark-crypto, compressed,
+// followed by the powers of G₂ if the key has them.
+func (pk *PublicKey) WriteTo(w io.Writer) (int64, error) {
+	n, err := pk.SRS.WriteTo(w)
+	if err != nil || pk.G2 == nil {
+		return n, err
+	}
+	enc := bls12377.NewEncoder(w)
+	err = enc.Encode(pk.G2)
+	return n + enc.BytesWritten(), err
+}
+
+// ReadFrom reads an SRS written by WriteTo or converted from a ceremony
+// transcript to the gnark-crypto encoding, optionally followed by the powers
+// of G₂. The points are checked to be in their subgroups and to be
+// successive powers of the same α, and the SRS is trimmed to SRSSize powers
+// of G₁ and MaxOpenPoints+1 powers of G₂.
+func (pk *PublicKey) ReadFrom(r io.Reader) (int64, error) {
+	srs := new(kzg.SRS)
+	n, err := srs.ReadFrom(r)
+	if err != nil {
+		return n, err
+	}
+	if err := checkSRS(srs); err != nil {
+		return n, err
+	}
+
+	var g2 []G2
+	dec := bls12377.NewDecoder(r)
+	err = dec.Decode(&g2)
+	n += dec.BytesRead()
+	switch {
+	case err == io.EOF && dec.BytesRead() == 0:
+		g2 = nil
+	case err != nil:
+		return n, err
+	default:
+		if err := checkG2(srs, g2); err != nil {
+			return n, err
+		}
+		g2 = g2[:MaxOpenPoints+1]
+	}
+
+	srs.Pk.G1 = append([]bls12377.G1Affine(nil), srs.Pk.G1[:SRSSize]...)
+	pk.SRS = srs
+	pk.G2 = g2
+	return n, nil
+}
+
+// LoadKey reads the SRS of the file at path with ReadFrom.
+func LoadKey(path string) (*PublicKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pk := new(PublicKey)
+	if _, err := pk.ReadFrom(f); err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
+
+// LoadOrGenKey loads the SRS at path with LoadKey, or generates a throwaway
+// key with GenKey if path is empty.
+func LoadOrGenKey(path string) (*PublicKey, error) {
+	if path == "" {
+		return GenKey()
+	}
+	return LoadKey(path)
+}
+
+// checkSRS verifies that srs holds [αⁱ]G₁ for i < SRSSize and [α]G₂ over the
+// standard generators, and recomputes the pairing lines of the verifying key
+// rather than trusting the encoded ones.
+//
+// e([αⁱ⁺¹]G₁, G₂) = e([αⁱ]G₁, [α]G₂) is checked for all i at once on a random
+// combination of the powers.
+func checkSRS(srs *kzg.SRS) error {
+	g1 := srs.Pk.G1
+	if len(g1) < SRSSize {
+		return errSRSSize
+	}
+	g1 = g1[:SRSSize]
+
+	_, _, gen1, gen2 := bls12377.Generators()
+	if !g1[0].Equal(&gen1) || !srs.Vk.G1.Equal(&gen1) || !srs.Vk.G2[0].Equal(&gen2) {
+		return errors.New("srs is not over the standard generators")
+	}
+	if srs.Vk.G2[1].IsInfinity() || srs.Vk.G2[1].Equal(&gen2) {
+		return errors.New("srs has a degenerate α")
+	}
+
+	coeffs := make([]fr.Element, len(g1)-1)
+	for i := range coeffs {
+		if _, err := coeffs[i].SetRandom(); err != nil {
+			return err
+		}
+	}
+	var lo, hi bls12377.G1Affine
+	if _, err := lo.MultiExp(g1[:len(g1)-1], coeffs, ecc.MultiExpConfig{}); err != nil {
+		return err
+	}
+	if _, err := hi.MultiExp(g1[1:], coeffs, ecc.MultiExpConfig{}); err != nil {
+		return err
+	}
+	lo.Neg(&lo)
+	ok, err := bls12377.PairingCheck(
+		[]bls12377.G1Affine{hi, lo},
+		[]bls12377.G2Affine{srs.Vk.G2[0], srs.Vk.G2[1]},
+	)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errSRSInvalid
+	}
+
+	srs.Vk.Lines[0] = bls12377.PrecomputeLines(srs.Vk.G2[0])
+	srs.Vk.Lines[1] = bls12377.PrecomputeLines(srs.Vk.G2[1])
+	return nil
+}
+
+// checkG2 verifies that g2 holds [αʲ]G₂ for j ≤ MaxOpenPoints with the α of
+// srs, checking e([α]G₁, [αʲ]G₂) = e(G₁, [αʲ⁺¹]G₂) on a random combination.
+func checkG2(srs *kzg.SRS, g2 []G2) error {
+	if len(g2) < MaxOpenPoints+1 {
+		return errSRSSize
+	}
+	g2 = g2[:MaxOpenPoints+1]
+	if !g2[0].Equal(&srs.Vk.G2[0]) || !g2[1].Equal(&srs.Vk.G2[1]) {
+		return errSRSInvalid
+	}
+
+	coeffs := make([]fr.Element, len(g2)-1)
+	for i := range coeffs {
+		if _, err := coeffs[i].SetRandom(); err != nil {
+			return err
+		}
+	}
+	var lo, hi bls12377.G2Affine
+	if _, err := lo.MultiExp(g2[:len(g2)-1], coeffs, ecc.MultiExpConfig{}); err != nil {
+		return err
+	}
+	if _, err := hi.MultiExp(g2[1:], coeffs, ecc.MultiExpConfig{}); err != nil {
+		return err
+	}
+	var negG1 bls12377.G1Affine
+	negG1.Neg(&srs.Pk.G1[0])
+	ok, err := bls12377.PairingCheck(
+		[]bls12377.G1Affine{srs.Pk.G1[1], negG1},
+		[]bls12377.G2Affine{lo, hi},
+	)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errSRSInvalid
+	}
+	return nil
+}
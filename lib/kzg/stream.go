@@ -0,0 +1,148 @@
+package kzg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bls12377 "github.com/consensys/gnark-crypto/ecc/bls12-377"
+)
+
+// readWindow is the number of shards read and multiplied at once by
+// CommitReader and OpenReader, which bounds their memory.
+const readWindow = 64
+
+// readShards reads the data of r and calls window on the shards that Split
+// would make of it, in order and readWindow at a time, from the second one
+// on. The first shard holds the length header, so it is returned last, once
+// the length is known.
+func readShards(r io.Reader, window func(start int, shards []Fr) error) (Fr, error) {
+	var first [ShardingLen]byte
+	n, err := io.ReadFull(r, first[HeaderLen:])
+	size := n
+	if err == nil {
+		buf := make([]byte, readWindow*ShardingLen)
+		shards := make([]Fr, readWindow)
+		for start := 1; err == nil; start += readWindow {
+			n, err = io.ReadFull(r, buf)
+			if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+				return Fr{}, err
+			}
+			if n == 0 {
+				break
+			}
+			size += n
+			if size > MaxFileSize {
+				return Fr{}, fmt.Errorf("data size too large")
+			}
+
+			for i := n; i < len(buf); i++ {
+				buf[i] = 0
+			}
+			num := (n + ShardingLen - 1) / ShardingLen
+			for i := 0; i < num; i++ {
+				shards[i].SetBytes(buf[ShardingLen*i : ShardingLen*(i+1)])
+			}
+			if err := window(start, shards[:num]); err != nil {
+				return Fr{}, err
+			}
+		}
+	}
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return Fr{}, err
+	}
+
+	binary.BigEndian.PutUint64(first[:], uint64(size))
+	var s Fr
+	s.SetBytes(first[:])
+	return s, nil
+}
+
+// CommitReader returns the commitment to the data read from r, the same as
+// Commitment, without holding more than readWindow shards in memory.
+func (pk *PublicKey) CommitReader(r io.Reader) (G1, error) {
+	var acc bls12377.G1Jac
+	var part G1
+	first, err := readShards(r, func(start int, shards []Fr) error {
+		if _, err := part.MultiExp(pk.Pk.G1[start:start+len(shards)], shards, ecc.MultiExpConfig{}); err != nil {
+			return err
+		}
+		acc.AddMixed(&part)
+		return nil
+	})
+	if err != nil {
+		return G1{}, err
+	}
+
+	part.ScalarMultiplication(&pk.Pk.G1[0], first.BigInt(new(big.Int)))
+	acc.AddMixed(&part)
+	var com G1
+	com.FromJacobian(&acc)
+	return com, nil
+}
+
+// OpenReader returns the opening at rnd of the data read from r, the same as
+// Open, without holding more than readWindow shards in memory.
+//
+// The quotient of f by x - z has the coefficients
+// qᵢ = z⁻⁽ⁱ⁺¹⁾(f(z) - Σⱼ≤ᵢ fⱼzʲ), so that with R = Σⱼ≥₁ fⱼzʲ the quotient
+// commitment is [R]A - B for A = Σ z⁻⁽ⁱ⁺¹⁾[αⁱ]G₁ and
+// B = Σ z⁻⁽ⁱ⁺¹⁾(Σ₁≤ⱼ≤ᵢ fⱼzʲ)[αⁱ]G₁, which are accumulated in order while f₀,
+// holding the length, is still unknown. At z = 0, qᵢ = fᵢ₊₁.
+func (pk *PublicKey) OpenReader(r io.Reader, rnd Fr) (Proof, error) {
+	var accA, accB bls12377.G1Jac
+	var part G1
+	var zInv, zInvPow, zPow, rest, t Fr
+	zInv.Inverse(&rnd)
+	zInvPow.SetOne()
+	zPow.SetOne()
+	scalarsA := make([]Fr, readWindow)
+	scalarsB := make([]Fr, readWindow)
+
+	first, err := readShards(r, func(start int, shards []Fr) error {
+		bases := pk.Pk.G1[start-1 : start-1+len(shards)]
+		if rnd.IsZero() {
+			if _, err := part.MultiExp(bases, shards, ecc.MultiExpConfig{}); err != nil {
+				return err
+			}
+			accA.AddMixed(&part)
+			return nil
+		}
+
+		for i := range shards {
+			zInvPow.Mul(&zInvPow, &zInv)
+			zPow.Mul(&zPow, &rnd)
+			scalarsA[i] = zInvPow
+			scalarsB[i].Mul(&zInvPow, &rest)
+			t.Mul(&shards[i], &zPow)
+			rest.Add(&rest, &t)
+		}
+		if _, err := part.MultiExp(bases, scalarsA[:len(shards)], ecc.MultiExpConfig{}); err != nil {
+			return err
+		}
+		accA.AddMixed(&part)
+		if _, err := part.MultiExp(bases, scalarsB[:len(shards)], ecc.MultiExpConfig{}); err != nil {
+			return err
+		}
+		accB.AddMixed(&part)
+		return nil
+	})
+	if err != nil {
+		return Proof{}, err
+	}
+
+	var pf Proof
+	if rnd.IsZero() {
+		pf.H.FromJacobian(&accA)
+		pf.ClaimedValue = first
+		return pf, nil
+	}
+	accA.ScalarMultiplication(&accA, rest.BigInt(new(big.Int)))
+	accB.Neg(&accB)
+	accA.AddAssign(&accB)
+	pf.H.FromJacobian(&accA)
+	pf.ClaimedValue.Add(&first, &rest)
+	return pf, nil
+}
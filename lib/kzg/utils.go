@@ -1,21 +1,55 @@
 package kzg
 
 import (
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"math/rand"
 )
 
+// Split encodes data as a blob of shards: the length of data on HeaderLen
+// bytes big-endian, then data, zero-padded to a multiple of ShardingLen
+// bytes. Every ShardingLen bytes make one shard, read big-endian, so that
+// shards are below 2²⁴⁸ and never wrap around the field. Join is the inverse.
 func Split(data []byte) []Fr {
-	num := (len(data)-1)/ShardingLen + 1
+	blob := make([]byte, (HeaderLen+len(data)+ShardingLen-1)/ShardingLen*ShardingLen)
+	binary.BigEndian.PutUint64(blob, uint64(len(data)))
+	copy(blob[HeaderLen:], data)
 
-	atom := make([]Fr, num)
-
-	for i := 0; i < num-1; i++ {
-		atom[i].SetBytes(data[ShardingLen*i : ShardingLen*(i+1)])
+	atom := make([]Fr, len(blob)/ShardingLen)
+	for i := range atom {
+		atom[i].SetBytes(blob[ShardingLen*i : ShardingLen*(i+1)])
 	}
+	return atom
+}
 
-	atom[num-1].SetBytes(data[ShardingLen*(num-1):])
+// Join returns the data encoded by Split in shards, which may be the
+// values downloaded by a retrieval client. It fails unless shards are
+// exactly such an encoding: every shard fits in ShardingLen bytes, the
+// length header matches the number of shards and the padding is zero.
+func Join(shards []Fr) ([]byte, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("no shards")
+	}
+	blob := make([]byte, 0, len(shards)*ShardingLen)
+	for i := range shards {
+		b := shards[i].Bytes()
+		if b[0] != 0 {
+			return nil, fmt.Errorf("shard %d exceeds %d bytes", i, ShardingLen)
+		}
+		blob = append(blob, b[1:]...)
+	}
 
-	return atom
+	n := binary.BigEndian.Uint64(blob)
+	if n > uint64(len(blob)-HeaderLen) || (HeaderLen+n+ShardingLen-1)/ShardingLen != uint64(len(shards)) {
+		return nil, errors.New("length header doesn't match the shards")
+	}
+	for _, b := range blob[HeaderLen+n:] {
+		if b != 0 {
+			return nil, errors.New("padding isn't zero")
+		}
+	}
+	return blob[HeaderLen : HeaderLen+n], nil
 }
 
 func GenRandom(len int) []byte {
@@ -0,0 +1,129 @@
+package merklecircuit
+
+import (
+	mbits "math/bits"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash"
+)
+
+// ArityCircuit verifies proofs of trees whose nodes have Arity children, as
+// returned by merkletree.Store.Prove. Path holds the leaf followed by the
+// Arity-1 siblings of every level, so it must be allocated with NewArity.
+// NumLeaves must be bound by the caller, see Circuit.NumLeaves.
+//
+// It does not save constraints: the hashers of this package absorb one
+// element per permutation, so a node of Arity children costs Arity
+// permutations, and the selection of the child position grows with Arity.
+// Over MiMC a proof in a tree of 1024 leaves costs 10394 constraints at
+// arity 2, 10452 at arity 4 and 16488 at arity 8 (BenchmarkVerifyProofArity).
+// Saving constraints would take a hash absorbing all children in one
+// permutation. Use it to verify proofs of stores built with another arity.
+type ArityCircuit struct {
+	Leaf      frontend.Variable
+	NumLeaves frontend.Variable
+	Path      []frontend.Variable
+	Arity     int `gnark:"-"`
+}
+
+// NewArity allocates a circuit for depth levels of arity children. The arity
+// must be a power of two.
+func NewArity(arity, depth int) ArityCircuit {
+	if arity < 2 || arity&(arity-1) != 0 {
+		panic("arity must be a power of two")
+	}
+	return ArityCircuit{
+		Path:  make([]frontend.Variable, 1+depth*(arity-1)),
+		Arity: arity,
+	}
+}
+
+// isDigit returns 1 if the bits of digit are those of j, 0 otherwise.
+func isDigit(api frontend.API, digit []frontend.Variable, j int) frontend.Variable {
+	var eq frontend.Variable = 1
+	for t := range digit {
+		if (j>>t)&1 == 1 {
+			eq = api.Mul(eq, digit[t])
+		} else {
+			eq = api.Mul(eq, api.Sub(1, digit[t]))
+		}
+	}
+	return eq
+}
+
+// nodeSumN returns the hash of the children of a node.
+func nodeSumN(api frontend.API, h hash.FieldHasher, children []frontend.Variable) frontend.Variable {
+
+	h.Reset()
+	writeTag(h, 1)
+	h.Write(children...)
+	res := h.Sum()
+
+	return res
+}
+
+// VerifyProof asserts that the first element of Path is the leaf at index
+// Leaf of the tree of NumLeaves leaves with the given root. Like
+// merkletree.VerifySizedProofArity, the tree must have the depth of the
+// circuit, Leaf must be below NumLeaves and the missing children of the last
+// node of a level must repeat its last child, so that the path proves a
+// single index.
+func (mp *ArityCircuit) VerifyProof(api frontend.API, h hash.FieldHasher, root frontend.Variable) {
+	arity := mp.Arity
+	logArity := mbits.Len(uint(arity)) - 1
+	depth := (len(mp.Path) - 1) / (arity - 1)
+	nbBits := depth * logArity
+
+	sum := leafSum(api, h, mp.Path[0])
+	if depth == 0 {
+		api.AssertIsEqual(mp.Leaf, 0)
+		api.AssertIsEqual(mp.NumLeaves, 1)
+		api.AssertIsEqual(sum, root)
+		return
+	}
+
+	// NumLeaves-1 has exactly depth digits, the top one isn't 0
+	binLeaf := api.ToBinary(mp.Leaf, nbBits)
+	binLast := api.ToBinary(api.Sub(mp.NumLeaves, 1), nbBits)
+	api.AssertIsEqual(api.IsZero(api.FromBinary(binLast[nbBits-logArity:]...)), 0)
+
+	eq := lastNodes(api, binLeaf, binLast)
+
+	children := make([]frontend.Variable, arity)
+	for i := 0; i < depth; i++ {
+		digit := binLeaf[i*logArity : (i+1)*logArity]
+		lastDigit := binLast[i*logArity : (i+1)*logArity]
+		siblings := mp.Path[1+i*(arity-1) : 1+(i+1)*(arity-1)]
+
+		// the node goes at position digit, siblings fill the others in order:
+		// child j is siblings[j] before the node and siblings[j-1] after it.
+		var after frontend.Variable = 0
+		for j := 0; j < arity; j++ {
+			at := isDigit(api, digit, j)
+
+			child := api.Mul(at, sum)
+			if j < arity-1 {
+				child = api.Add(child, api.Mul(api.Sub(1, at, after), siblings[j]))
+			}
+			if j > 0 {
+				child = api.Add(child, api.Mul(after, siblings[j-1]))
+			}
+			children[j] = child
+			after = api.Add(after, at)
+		}
+
+		// in the last node of the level, the children after the last one
+		// repeat it
+		var padding frontend.Variable = 0
+		for j := 1; j < arity; j++ {
+			padding = api.Add(padding, isDigit(api, lastDigit, j-1))
+			alone := api.Mul(eq[(i+1)*logArity], padding)
+			api.AssertIsEqual(api.Mul(alone, api.Sub(children[j], children[j-1])), 0)
+		}
+
+		sum = nodeSumN(api, h, children)
+	}
+
+	// Compare our calculated Merkle root to the desired Merkle root.
+	api.AssertIsEqual(sum, root)
+}
@@ -0,0 +1,180 @@
+package merklecircuit
+
+import (
+	"errors"
+	gohash "hash"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash"
+	"github.com/consensys/gnark/std/lookup/logderivlookup"
+	"github.com/yydfjt/gnark-example/lib/merkletree"
+)
+
+// BatchCircuit verifies a merkletree.MultiProof of k leaves of a tree of
+// NumLeaves leaves. The shape of a circuit can't depend on the indices, so
+// every leaf is walked up to Height, the lowest level of at most k nodes,
+// and from there every node of the levels above is hashed once for all
+// leaves. The number of hashes is the sum over the levels of the smaller of
+// k and the level width, instead of k times the depth for k independent
+// proofs; below Height a node shared by two leaves is hashed by both, which
+// the k hashes a level must budget for anyway.
+//
+// Top holds the nodes at Height, Known flags those reached by a leaf and
+// Upper the nodes of the levels above that no leaf reaches, given as hashes
+// by the multiproof. The sizes are fixed when the circuit is compiled, the
+// slices are allocated by NewBatch.
+type BatchCircuit struct {
+	Indices   []frontend.Variable
+	Leaves    []frontend.Variable
+	Paths     [][]frontend.Variable // siblings of each leaf below Height
+	Top       []frontend.Variable
+	Known     []frontend.Variable
+	Upper     [][]frontend.Variable
+	NumLeaves uint64 `gnark:"-"`
+}
+
+// batchHeight returns the lowest level of a tree of numLeaves leaves with at
+// most k nodes.
+func batchHeight(numLeaves uint64, k int) int {
+	height := 0
+	for merkletree.LevelWidth(numLeaves, 2, height) > uint64(k) {
+		height++
+	}
+	return height
+}
+
+// NewBatch allocates a circuit for k leaves of a tree of numLeaves leaves.
+func NewBatch(k int, numLeaves uint64) BatchCircuit {
+	if k <= 0 || numLeaves == 0 {
+		panic("invalid batch size")
+	}
+
+	height := batchHeight(numLeaves, k)
+	width := merkletree.LevelWidth(numLeaves, 2, height)
+	c := BatchCircuit{
+		Indices:   make([]frontend.Variable, k),
+		Leaves:    make([]frontend.Variable, k),
+		Paths:     make([][]frontend.Variable, k),
+		Top:       make([]frontend.Variable, width),
+		Known:     make([]frontend.Variable, width),
+		NumLeaves: numLeaves,
+	}
+	for i := range c.Paths {
+		c.Paths[i] = make([]frontend.Variable, height)
+	}
+	for l := height + 1; l <= merkletree.TreeDepth(numLeaves, 2); l++ {
+		c.Upper = append(c.Upper, make([]frontend.Variable, merkletree.LevelWidth(numLeaves, 2, l)))
+	}
+	return c
+}
+
+// Assign sets a proof returned by merkletree.BuildReaderMultiProof, whose
+// nodes are recomputed with h.
+func (c *BatchCircuit) Assign(h gohash.Hash, mp *merkletree.MultiProof) error {
+	if mp == nil || len(mp.Indices) != len(c.Indices) || mp.NumLeaves != c.NumLeaves {
+		return errors.New("multiproof doesn't fit the circuit")
+	}
+	nodes, ok := mp.Nodes(h)
+	if !ok {
+		return errors.New("invalid multiproof")
+	}
+	node := func(height int, p uint64) frontend.Variable {
+		if n, ok := nodes[height][p]; ok {
+			return n
+		}
+		return 0
+	}
+
+	height := len(c.Paths[0])
+	for k, i := range mp.Indices {
+		c.Indices[k] = i
+		c.Leaves[k] = mp.Leaves[k]
+		for l := 0; l < height; l++ {
+			sibling := i ^ 1
+			if sibling >= merkletree.LevelWidth(c.NumLeaves, 2, l) {
+				sibling = i
+			}
+			c.Paths[k][l] = node(l, sibling)
+			i /= 2
+		}
+	}
+	for j := range c.Top {
+		c.Top[j] = node(height, uint64(j))
+		c.Known[j] = 0
+	}
+	for _, i := range mp.Indices {
+		c.Known[i>>uint(height)] = 1
+	}
+	for u := range c.Upper {
+		for j := range c.Upper[u] {
+			c.Upper[u][j] = node(height+1+u, uint64(j))
+		}
+	}
+	return nil
+}
+
+// VerifyProof asserts that every leaf is at its index in the tree with the
+// given root. Indices are canonical as in Circuit.VerifyProof.
+func (c *BatchCircuit) VerifyProof(api frontend.API, h hash.FieldHasher, root frontend.Variable) {
+	depth := merkletree.TreeDepth(c.NumLeaves, 2)
+	height := len(c.Paths[0])
+	width := len(c.Top)
+
+	binLast := make([]frontend.Variable, depth)
+	for k := range binLast {
+		binLast[k] = ((c.NumLeaves - 1) >> uint(k)) & 1
+	}
+
+	// the nodes at Height and their flags, looked up by position
+	table := logderivlookup.New(api)
+	for j := range c.Top {
+		table.Insert(c.Top[j])
+	}
+	for j := range c.Known {
+		api.AssertIsBoolean(c.Known[j])
+		table.Insert(c.Known[j])
+	}
+
+	for i := range c.Indices {
+		binLeaf := api.ToBinary(c.Indices[i], depth)
+		eq := lastNodes(api, binLeaf, binLast)
+
+		sum := leafSum(api, h, c.Leaves[i])
+		for k, sibling := range c.Paths[i] {
+			assertPadding(api, eq[k], binLeaf[k], sibling, sum)
+
+			d1 := api.Select(binLeaf[k], sibling, sum)
+			d2 := api.Select(binLeaf[k], sum, sibling)
+			sum = nodeSum(api, h, d1, d2)
+		}
+
+		// the node reached is the known one of Top at the remaining index bits
+		var top frontend.Variable = 0
+		if height < depth {
+			top = api.FromBinary(binLeaf[height:]...)
+		}
+		res := table.Lookup(top, api.Add(top, width))
+		api.AssertIsEqual(res[0], sum)
+		api.AssertIsEqual(res[1], 1)
+	}
+
+	// a node above a known one is hashed, the others are taken from Upper
+	level, known := c.Top, c.Known
+	for _, upper := range c.Upper {
+		next := make([]frontend.Variable, len(upper))
+		nextKnown := make([]frontend.Variable, len(upper))
+		for j := range upper {
+			left, right := 2*j, 2*j+1
+			if right == len(level) {
+				right = left
+			}
+			nextKnown[j] = api.Or(known[left], known[right])
+			next[j] = api.Select(nextKnown[j], nodeSum(api, h, level[left], level[right]), upper[j])
+		}
+		level, known = next, nextKnown
+	}
+
+	// Compare our calculated Merkle root to the desired Merkle root. At least
+	// one leaf is known, so the root is hashed.
+	api.AssertIsEqual(level[0], root)
+}
@@ -0,0 +1,189 @@
+package merklecircuit
+
+import (
+	"errors"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash"
+	"github.com/consensys/gnark/std/hash/sha2"
+	"github.com/consensys/gnark/std/hash/sha3"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/yydfjt/gnark-example/lib/merkletree"
+)
+
+// BinaryHasher is a byte oriented hash that can be reset, like the SHA-256
+// and Keccak-256 of gnark.
+type BinaryHasher interface {
+	hash.BinaryHasher
+	Reset()
+}
+
+// NewBinaryHasher returns the circuit counterpart of a byte oriented native
+// hash, merkletree.HashSHA256 or merkletree.HashKeccak256.
+func NewBinaryHasher(api frontend.API, id merkletree.HashID) (BinaryHasher, error) {
+	var h hash.BinaryHasher
+	var err error
+	switch id {
+	case merkletree.HashSHA256:
+		h, err = sha2.New(api)
+	case merkletree.HashKeccak256:
+		h, err = sha3.NewLegacyKeccak256(api)
+	default:
+		return nil, errors.New("hash has no byte oriented counterpart")
+	}
+	if err != nil {
+		return nil, err
+	}
+	bh, ok := h.(BinaryHasher)
+	if !ok {
+		return nil, errors.New("hash can't be reset")
+	}
+	return bh, nil
+}
+
+type binaryDomainHasher struct {
+	BinaryHasher
+	domain merkletree.Domain
+}
+
+// WithBinaryDomain returns h separating leaves and nodes like
+// merkletree.WithDomain. Only merkletree.DomainNone and
+// merkletree.DomainRFC6962 are supported.
+func WithBinaryDomain(h BinaryHasher, d merkletree.Domain) BinaryHasher {
+	if d != merkletree.DomainNone && d != merkletree.DomainRFC6962 {
+		panic("domain not supported by binary hashers")
+	}
+	if dh, ok := h.(*binaryDomainHasher); ok {
+		h = dh.BinaryHasher
+	}
+	return &binaryDomainHasher{
+		BinaryHasher: h,
+		domain:       d,
+	}
+}
+
+func binarySum(h BinaryHasher, tag uint8, data ...[]uints.U8) []uints.U8 {
+	h.Reset()
+	if dh, ok := h.(*binaryDomainHasher); ok && dh.domain == merkletree.DomainRFC6962 {
+		h.Write([]uints.U8{uints.NewU8(tag)})
+	}
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum()
+}
+
+// BinaryCircuit verifies a proof of a merkletree.ProofTree hashed with SHA-256
+// or Keccak-256, so that roots published outside of the circuit world can be
+// checked. Data is the leaf segment and Path holds the 32 bytes siblings of
+// the proof set returned by Prove. The sizes are fixed when the circuit is
+// compiled, the slices are allocated by NewBinary, or by NewBinaryLast for
+// the shorter last segment of data that isn't a multiple of SegmentSize.
+type BinaryCircuit struct {
+	Leaf        frontend.Variable
+	NumLeaves   frontend.Variable
+	Data        []uints.U8
+	Path        [][]uints.U8
+	SegmentSize int `gnark:"-"`
+}
+
+// NewBinary allocates a circuit for trees of depth levels and leaves of
+// segmentSize bytes.
+func NewBinary(depth, segmentSize int) BinaryCircuit {
+	return NewBinaryLast(depth, segmentSize, segmentSize)
+}
+
+// NewBinaryLast allocates a circuit for the last leaf of trees of depth
+// levels and leaves of segmentSize bytes, when it only holds size bytes.
+func NewBinaryLast(depth, segmentSize, size int) BinaryCircuit {
+	if depth < 0 || segmentSize <= 0 || size <= 0 || size > segmentSize {
+		panic("invalid tree shape")
+	}
+	mp := BinaryCircuit{
+		Data:        make([]uints.U8, size),
+		Path:        make([][]uints.U8, depth),
+		SegmentSize: segmentSize,
+	}
+	for i := range mp.Path {
+		mp.Path[i] = make([]uints.U8, 32)
+	}
+	return mp
+}
+
+// Assign sets a proof returned by merkletree.BuildReaderProof.
+func (mp *BinaryCircuit) Assign(proofSet [][]byte, index, numLeaves uint64) error {
+	if len(proofSet) != len(mp.Path)+1 || len(proofSet[0]) != len(mp.Data) {
+		return errProofSize
+	}
+	for i := 1; i < len(proofSet); i++ {
+		if len(proofSet[i]) != len(mp.Path[i-1]) {
+			return errProofSize
+		}
+	}
+	if mp.short() && index != numLeaves-1 {
+		return errors.New("only the last leaf can be short")
+	}
+
+	mp.Leaf = index
+	mp.NumLeaves = numLeaves
+	copy(mp.Data, uints.NewU8Array(proofSet[0]))
+	for i := range mp.Path {
+		copy(mp.Path[i], uints.NewU8Array(proofSet[i+1]))
+	}
+	return nil
+}
+
+func (mp *BinaryCircuit) short() bool {
+	return len(mp.Data) < mp.SegmentSize
+}
+
+// VerifyProof asserts that Data is the leaf at index Leaf of the tree of
+// NumLeaves leaves with the given root. The index is canonical as in
+// Circuit.VerifyProof. The bytes of Data and Path are range checked, root
+// is compared to hashed bytes.
+func (mp *BinaryCircuit) VerifyProof(api frontend.API, h BinaryHasher, root []uints.U8) {
+	bf, err := uints.New[uints.U32](api)
+	if err != nil {
+		panic(err)
+	}
+
+	depth := len(mp.Path)
+	data := make([]uints.U8, len(mp.Data))
+	for j := range mp.Data {
+		data[j] = bf.ByteValueOf(mp.Data[j].Val)
+	}
+	sum := binarySum(h, 0, data)
+
+	binLeaf, eq, _ := canonicalIndex(api, mp.Leaf, mp.NumLeaves, depth, depth)
+	if mp.short() {
+		api.AssertIsEqual(mp.Leaf, api.Sub(mp.NumLeaves, 1))
+	}
+
+	for i, sibling := range mp.Path {
+		if len(sibling) != len(sum) {
+			panic("sibling size doesn't match the hash")
+		}
+
+		// the last node of a level on a left position has no sibling
+		alone := api.Mul(eq[i], api.Sub(1, binLeaf[i]))
+
+		d1 := make([]uints.U8, len(sum))
+		d2 := make([]uints.U8, len(sum))
+		for j := range sum {
+			api.AssertIsEqual(api.Mul(alone, api.Sub(sibling[j].Val, sum[j].Val)), 0)
+
+			// the sibling byte is one of the two, so both are range checked
+			d1[j] = bf.ByteValueOf(api.Select(binLeaf[i], sibling[j].Val, sum[j].Val))
+			d2[j] = bf.ByteValueOf(api.Select(binLeaf[i], sum[j].Val, sibling[j].Val))
+		}
+		sum = binarySum(h, 1, d1, d2)
+	}
+
+	// Compare our calculated Merkle root to the desired Merkle root.
+	if len(root) != len(sum) {
+		panic("root size doesn't match the hash")
+	}
+	for j := range sum {
+		api.AssertIsEqual(sum[j].Val, root[j].Val)
+	}
+}
@@ -1,24 +1,87 @@
 package merklecircuit
 
 import (
+	"errors"
+
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/hash"
+	"github.com/yydfjt/gnark-example/lib/merkletree"
 )
 
-const Depth = 6
-
 // MerkleProof stores the path, the root hash and an helper for the Merkle proof.
 type Circuit struct {
-	// Path path of the Merkle proof
 	Leaf frontend.Variable
-	Path [Depth + 1]frontend.Variable
+
+	// NumLeaves is the size of the tree. It is a witness like Leaf, so the
+	// caller must bind it, e.g. to a public input: a tree of odd size pairs
+	// its last node with itself, so it could be claimed to have one more
+	// leaf and the copy at that padding slot proven or updated as a leaf.
+	NumLeaves frontend.Variable
+
+	// Path path of the Merkle proof, allocated by New
+	Path []frontend.Variable
+}
+
+// New allocates a circuit for trees of depth levels, i.e. of more than
+// 1<<(depth-1) and at most 1<<depth leaves.
+func New(depth int) Circuit {
+	if depth < 0 {
+		panic("invalid tree depth")
+	}
+	return Circuit{
+		Path: make([]frontend.Variable, depth+1),
+	}
+}
+
+// Assign sets the leaf index and the path of a proof built with the field
+// element API of merkletree, e.g. bn254.BuildProof. The proof must have the
+// depth of the circuit.
+func Assign[E any](mp *Circuit, p merkletree.FieldProof[E]) error {
+	if len(p.Path) != len(mp.Path) {
+		return errors.New("proof depth doesn't match the circuit")
+	}
+	mp.Leaf = p.Index
+	mp.NumLeaves = p.NumLeaves
+	for i := range p.Path {
+		mp.Path[i] = p.Path[i]
+	}
+	return nil
+}
+
+type domainHasher struct {
+	hash.FieldHasher
+	domain merkletree.Domain
+}
+
+// WithDomain returns h separating leaves and nodes like merkletree.WithDomain.
+// Only merkletree.DomainNone and merkletree.DomainTagged can be expressed
+// over field elements.
+func WithDomain(h hash.FieldHasher, d merkletree.Domain) hash.FieldHasher {
+	if d != merkletree.DomainNone && d != merkletree.DomainTagged {
+		panic("domain not supported by field hashers")
+	}
+	if dh, ok := h.(*domainHasher); ok {
+		h = dh.FieldHasher
+	}
+	return &domainHasher{
+		FieldHasher: h,
+		domain:      d,
+	}
+}
+
+// writeTag writes the domain tag of a leaf or a node, if any.
+func writeTag(h hash.FieldHasher, tag int) {
+	if dh, ok := h.(*domainHasher); ok && dh.domain == merkletree.DomainTagged {
+		h.Write(tag)
+	}
 }
 
 // leafSum returns the hash created from data inserted to form a leaf.
-// Without domain separation.
+// Domain separated only if h was wrapped by WithDomain.
 func leafSum(api frontend.API, h hash.FieldHasher, data frontend.Variable) frontend.Variable {
 
 	h.Reset()
+	writeTag(h, 0)
 	h.Write(data)
 	res := h.Sum()
 
@@ -26,20 +89,35 @@ func leafSum(api frontend.API, h hash.FieldHasher, data frontend.Variable) front
 }
 
 // nodeSum returns the hash created from data inserted to form a leaf.
-// Without domain separation.
+// Domain separated only if h was wrapped by WithDomain.
 func nodeSum(api frontend.API, h hash.FieldHasher, a, b frontend.Variable) frontend.Variable {
 
 	h.Reset()
+	writeTag(h, 1)
 	h.Write(a, b)
 	res := h.Sum()
 
 	return res
 }
 
-// VerifyProof takes a Merkle root, a proofSet, and a proofIndex and returns
-// true if the first element of the proof set is a leaf of data in the Merkle
-// root. False is returned if the proof set or Merkle root is nil, and if
-// 'numLeaves' equals 0.
+// LeafSum returns the hash of a leaf as Circuit computes it, for circuits
+// of trees built on top of lib/merkletree such as lib/smtcircuit.
+func LeafSum(api frontend.API, h hash.FieldHasher, data frontend.Variable) frontend.Variable {
+	return leafSum(api, h, data)
+}
+
+// NodeSum returns the hash of two nodes as Circuit computes it.
+func NodeSum(api frontend.API, h hash.FieldHasher, a, b frontend.Variable) frontend.Variable {
+	return nodeSum(api, h, a, b)
+}
+
+// VerifyProof asserts that the first element of Path is the leaf at index
+// Leaf of the tree of NumLeaves leaves, i.e. that it hashes to root along the
+// siblings of Path. Like merkletree.VerifySizedProof, the index is
+// canonical: the tree must have the depth of the circuit, Leaf must be below
+// NumLeaves and a node without sibling must be paired with itself, so that
+// the path proves a single index. NumLeaves must be bound by the caller, see
+// Circuit.NumLeaves.
 func (mp *Circuit) VerifyProof(api frontend.API, h hash.FieldHasher, root frontend.Variable) {
 
 	depth := len(mp.Path) - 1
@@ -48,10 +126,13 @@ func (mp *Circuit) VerifyProof(api frontend.API, h hash.FieldHasher, root fronte
 	// The binary decomposition is the bitwise negation of the order of hashes ->
 	// If the path in the plain go code is 					0 1 1 0 1 0
 	// The binary decomposition of the leaf index will be 	1 0 0 1 0 1 (little endian)
-	binLeaf := api.ToBinary(mp.Leaf, depth)
+	binLeaf, eq, _ := canonicalIndex(api, mp.Leaf, mp.NumLeaves, depth, depth)
 
 	//api.Println("leaf: ", mp.Leaf, binLeaf)
 	for i := 1; i < len(mp.Path); i++ { // the size of the loop is fixed -> one circuit per size
+		// the last node of a level on a left position has no sibling
+		assertPadding(api, eq[i-1], binLeaf[i-1], mp.Path[i], sum)
+
 		d1 := api.Select(binLeaf[i-1], mp.Path[i], sum)
 		d2 := api.Select(binLeaf[i-1], sum, mp.Path[i])
 		sum = nodeSum(api, h, d1, d2)
@@ -60,3 +141,68 @@ func (mp *Circuit) VerifyProof(api frontend.API, h hash.FieldHasher, root fronte
 	// Compare our calculated Merkle root to the desired Merkle root.
 	api.AssertIsEqual(sum, root)
 }
+
+// canonicalIndex decomposes leaf on maxDepth bits and asserts that it is
+// below numLeaves, whose tree has depth levels: depth is at most maxDepth and
+// numLeaves-1 has exactly depth bits. It returns the bits of leaf, eq as
+// returned by lastNodes, and active where active[k] is 1 while k <= depth.
+// A constant depth only costs the check of the top bit of numLeaves-1.
+func canonicalIndex(api frontend.API, leaf, numLeaves, depth frontend.Variable, maxDepth int) (binLeaf, eq, active []frontend.Variable) {
+	active = make([]frontend.Variable, maxDepth+2)
+	active[maxDepth+1] = 0
+	isDepth := make([]frontend.Variable, maxDepth+1)
+	for k := maxDepth; k >= 0; k-- {
+		isDepth[k] = api.IsZero(api.Sub(depth, k))
+		active[k] = api.Add(active[k+1], isDepth[k])
+	}
+	api.AssertIsEqual(active[0], 1)
+
+	// gnark can't decompose on no bits
+	if maxDepth == 0 {
+		api.AssertIsEqual(leaf, 0)
+		api.AssertIsEqual(numLeaves, 1)
+		return nil, []frontend.Variable{1}, active
+	}
+
+	binLeaf = api.ToBinary(leaf, maxDepth)
+	binLast := api.ToBinary(api.Sub(numLeaves, 1), maxDepth)
+	_, fixed := api.Compiler().ConstantValue(depth)
+	var top frontend.Variable = isDepth[0]
+	for k := 0; k < maxDepth; k++ {
+		if !fixed {
+			api.AssertIsEqual(api.Mul(binLast[k], api.Sub(1, active[k+1])), 0)
+		}
+		top = api.Add(top, api.Mul(isDepth[k+1], binLast[k]))
+	}
+	api.AssertIsEqual(top, 1)
+
+	return binLeaf, lastNodes(api, binLeaf, binLast), active
+}
+
+// lastNodes asserts that leaf <= last given their bits, and returns eq where
+// eq[k] is 1 if both have the same bits from k up, i.e. the node of leaf at
+// height k is the last of its level.
+func lastNodes(api frontend.API, binLeaf, binLast []frontend.Variable) []frontend.Variable {
+	depth := len(binLeaf)
+	eq := make([]frontend.Variable, depth+1)
+	eq[depth] = 1
+	for k := depth - 1; k >= 0; k-- {
+		eq[k] = api.Mul(eq[k+1], api.Sub(1, api.Xor(binLeaf[k], binLast[k])))
+	}
+
+	// leaf has a 0 at the highest differing bit
+	var above frontend.Variable = 0
+	for k := 0; k < depth; k++ {
+		above = api.Add(above, api.Mul(api.Sub(eq[k+1], eq[k]), binLeaf[k]))
+	}
+	api.AssertIsEqual(above, 0)
+
+	return eq
+}
+
+// assertPadding asserts that a node on a left position that is the last of
+// its level is paired with itself.
+func assertPadding(api frontend.API, last, bit, sibling, sum frontend.Variable) {
+	alone := api.Mul(last, api.Sub(1, bit))
+	api.AssertIsEqual(api.Mul(alone, api.Sub(sibling, sum)), 0)
+}
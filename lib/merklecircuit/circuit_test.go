@@ -0,0 +1,1020 @@
+package merklecircuit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bls377 "github.com/consensys/gnark-crypto/ecc/bls12-377/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/hash"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/hash/mimc"
+	"github.com/consensys/gnark/std/math/uints"
+	"github.com/consensys/gnark/test"
+	"github.com/yydfjt/gnark-example/lib/merkletree"
+	"github.com/yydfjt/gnark-example/lib/merkletree/bn254"
+)
+
+const testDepth = 6
+
+type testCircuit struct {
+	M      Circuit
+	Root   frontend.Variable `gnark:",public"`
+	Domain merkletree.Domain `gnark:"-"`
+}
+
+func (c *testCircuit) Define(api frontend.API) error {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	c.M.VerifyProof(api, WithDomain(&h, c.Domain), c.Root)
+	return nil
+}
+
+// genProof builds a MiMC tree over random field elements and returns the
+// proof of index, ready for assignment.
+func genProof(t *testing.T, d merkletree.Domain, numLeaves int, index uint64) (root []byte, proofSet [][]byte) {
+	mod := ecc.BN254.ScalarField()
+	fieldSize := len(mod.Bytes())
+
+	var buf bytes.Buffer
+	for i := 0; i < numLeaves; i++ {
+		leaf, _ := rand.Int(rand.Reader, mod)
+		b := leaf.Bytes()
+		buf.Write(make([]byte, fieldSize-len(b)))
+		buf.Write(b)
+	}
+
+	h := merkletree.WithDomain(hash.MIMC_BN254.New(), d)
+	root, proofSet, _, err := merkletree.BuildReaderProof(&buf, h, fieldSize, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !merkletree.VerifyProof(merkletree.WithDomain(hash.MIMC_BN254.New(), d), root, proofSet, index) {
+		t.Fatal("wrong native proof")
+	}
+	return root, proofSet
+}
+
+func TestVerifyProofDomain(t *testing.T) {
+	numLeaves := 1<<(testDepth-1) + 8
+	index := uint64(numLeaves - 3)
+
+	for _, d := range []merkletree.Domain{merkletree.DomainNone, merkletree.DomainTagged} {
+		root, proofSet := genProof(t, d, numLeaves, index)
+
+		assignment := testCircuit{M: New(testDepth)}
+		assignment.Root = root
+		assignment.M.Leaf = index
+		assignment.M.NumLeaves = numLeaves
+		for i := range assignment.M.Path {
+			assignment.M.Path[i] = proofSet[i]
+		}
+
+		err := test.IsSolved(&testCircuit{M: New(testDepth), Domain: d}, &assignment, ecc.BN254.ScalarField())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		other := merkletree.DomainTagged
+		if d == merkletree.DomainTagged {
+			other = merkletree.DomainNone
+		}
+		err = test.IsSolved(&testCircuit{M: New(testDepth), Domain: other}, &assignment, ecc.BN254.ScalarField())
+		if err == nil {
+			t.Fatal("proof accepted with another domain")
+		}
+	}
+}
+
+func TestVerifyProofDepths(t *testing.T) {
+	for _, depth := range []int{0, 1, 3, 10} {
+		for _, numLeaves := range []int{1<<depth/2 + 1, 1 << depth} {
+			leaves := make([]fr.Element, numLeaves)
+			for i := range leaves {
+				leaves[i].SetRandom()
+			}
+			proof, err := bn254.BuildProof(leaves, uint64(numLeaves-1))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assignment := testCircuit{M: New(depth), Root: proof.Root}
+			if err := Assign(&assignment.M, proof); err != nil {
+				t.Fatal(depth, numLeaves, err)
+			}
+			err = test.IsSolved(&testCircuit{M: New(depth)}, &assignment, ecc.BN254.ScalarField())
+			if err != nil {
+				t.Fatal(depth, numLeaves, err)
+			}
+		}
+	}
+}
+
+func TestAssignFieldProof(t *testing.T) {
+	leaves := make([]fr.Element, 1<<(testDepth-1)+8)
+	for i := range leaves {
+		leaves[i].SetRandom()
+	}
+
+	proof, err := bn254.BuildProof(leaves, uint64(len(leaves)-3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assignment := testCircuit{M: New(testDepth)}
+	assignment.Root = proof.Root
+	err = Assign(&assignment.M, proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = test.IsSolved(&testCircuit{M: New(testDepth)}, &assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err = bn254.BuildProof(leaves[:4], 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Assign(&assignment.M, proof) == nil {
+		t.Fatal("proof of another depth should not be assigned")
+	}
+}
+
+type hashCircuit struct {
+	M    Circuit
+	Root frontend.Variable `gnark:",public"`
+	Hash merkletree.HashID `gnark:"-"`
+}
+
+func (c *hashCircuit) Define(api frontend.API) error {
+	h, err := NewHasher(api, c.Hash)
+	if err != nil {
+		return err
+	}
+	c.M.VerifyProof(api, h, c.Root)
+	return nil
+}
+
+// hashProof builds a tree of random leaves with the hash id and checks its
+// proof in circuit with the counterpart of every given hash.
+func hashProof[E any, PE merkletree.Element[E]](t *testing.T, curve ecc.ID, id merkletree.HashID, hashes []merkletree.HashID) {
+	leaves := make([]E, 1<<(testDepth-1)+8)
+	for i := range leaves {
+		b := make([]byte, 8)
+		rand.Read(b)
+		PE(&leaves[i]).SetBytes(b)
+	}
+	h, err := id.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := merkletree.BuildFieldProof[E, PE](h, leaves, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assignment := hashCircuit{M: New(testDepth)}
+	assignment.Root = proof.Root
+	if err := Assign(&assignment.M, proof); err != nil {
+		t.Fatal(err)
+	}
+	for _, other := range hashes {
+		err := test.IsSolved(&hashCircuit{M: New(testDepth), Hash: other}, &assignment, curve.ScalarField())
+		if other == id && err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		if other != id && err == nil {
+			t.Fatalf("%s tree accepted with %s", id, other)
+		}
+	}
+}
+
+func TestVerifyProofHash(t *testing.T) {
+	bn254Hashes := []merkletree.HashID{merkletree.HashMiMCBN254, merkletree.HashPoseidon2BN254, merkletree.HashPoseidon2BLS12377}
+	for _, id := range bn254Hashes[:2] {
+		hashProof[fr.Element](t, ecc.BN254, id, bn254Hashes)
+	}
+	bls12377Hashes := []merkletree.HashID{merkletree.HashMiMCBLS12377, merkletree.HashPoseidon2BLS12377, merkletree.HashPoseidon2BN254}
+	for _, id := range bls12377Hashes[:2] {
+		hashProof[bls377.Element](t, ecc.BLS12_377, id, bls12377Hashes)
+	}
+}
+
+func TestVerifyProofAliasedIndex(t *testing.T) {
+	field := ecc.BN254.ScalarField()
+	numLeaves := 1<<(testDepth-1) + 8
+	leaves := make([]fr.Element, numLeaves)
+	for i := range leaves {
+		leaves[i].SetRandom()
+	}
+
+	// the last leaf of an odd tree is paired with itself, so its path also
+	// leads to the root from the padding index
+	odd, err := bn254.BuildProof(leaves[:numLeaves-1], uint64(numLeaves-2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	even, err := bn254.BuildProof(leaves, uint64(numLeaves-2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		proof     bn254.Proof
+		leaf      uint64
+		numLeaves uint64
+		ok        bool
+	}{
+		{"valid odd", odd, odd.Index, odd.NumLeaves, true},
+		{"valid even", even, even.Index, even.NumLeaves, true},
+		{"padding index", odd, odd.NumLeaves, odd.NumLeaves, false},
+		{"index above leaf count", even, even.Index, even.Index, false},
+		{"high index bit", even, even.Index + 1<<testDepth, even.NumLeaves, false},
+		{"smaller tree", even, even.Index, even.NumLeaves - 1, false},
+		{"shallower tree", even, even.Index % (1 << (testDepth - 1)), 1 << (testDepth - 1), false},
+	} {
+		assignment := testCircuit{M: New(testDepth)}
+		assignment.Root = tc.proof.Root
+		if err := Assign(&assignment.M, tc.proof); err != nil {
+			t.Fatal(err)
+		}
+		assignment.M.Leaf = tc.leaf
+		assignment.M.NumLeaves = tc.numLeaves
+
+		err := test.IsSolved(&testCircuit{M: New(testDepth)}, &assignment, field)
+		if (err == nil) != tc.ok {
+			t.Fatal(tc.name, err)
+		}
+	}
+}
+
+type varDepthCircuit struct {
+	M     VarDepthCircuit
+	Root  frontend.Variable `gnark:",public"`
+	Depth frontend.Variable `gnark:",public"`
+}
+
+func (c *varDepthCircuit) Define(api frontend.API) error {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(c.M.Depth, c.Depth)
+	c.M.VerifyProof(api, &h, c.Root)
+	return nil
+}
+
+func TestVerifyVarDepth(t *testing.T) {
+	field := ecc.BN254.ScalarField()
+	fieldSize := len(field.Bytes())
+	const maxDepth = 6
+
+	var buf bytes.Buffer
+	for i := 0; i < 1<<maxDepth; i++ {
+		leaf, _ := rand.Int(rand.Reader, field)
+		buf.Write(leaf.FillBytes(make([]byte, fieldSize)))
+	}
+	data := buf.Bytes()
+
+	// one system for all tree sizes
+	ccs, err := frontend.Compile(field, r1cs.NewBuilder, &varDepthCircuit{M: NewVarDepth(maxDepth)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	isSolved := func(assignment *varDepthCircuit) bool {
+		w, err := frontend.NewWitness(assignment, field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ccs.IsSolved(w) == nil
+	}
+
+	for numLeaves := uint64(1); numLeaves <= 1<<maxDepth; numLeaves++ {
+		for _, index := range []uint64{0, numLeaves / 2, numLeaves - 1} {
+			r := bytes.NewReader(data[:int(numLeaves)*fieldSize])
+			root, proofSet, _, err := merkletree.BuildReaderProof(r, hash.MIMC_BN254.New(), fieldSize, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assignment := varDepthCircuit{M: NewVarDepth(maxDepth), Root: root}
+			if err := assignment.M.Assign(proofSet, index, numLeaves); err != nil {
+				t.Fatal(err)
+			}
+			assignment.Depth = assignment.M.Depth
+			if !isSolved(&assignment) {
+				t.Fatal("valid proof rejected: ", numLeaves, index)
+			}
+
+			// a longer path of zeros or a shorter one doesn't lead to the root,
+			// and the depth must match the leaf count anyway
+			depth := len(proofSet) - 1
+			for _, other := range []int{depth - 1, depth + 1} {
+				if other < 0 || other > maxDepth {
+					continue
+				}
+				assignment.M.Depth = other
+				assignment.Depth = other
+				if isSolved(&assignment) {
+					t.Fatal("proof accepted with another depth: ", numLeaves, index, other)
+				}
+			}
+			assignment.M.Depth = depth
+			assignment.Depth = depth
+
+			assignment.M.Leaf = numLeaves
+			if isSolved(&assignment) {
+				t.Fatal("index out of range accepted: ", numLeaves, index)
+			}
+			assignment.M.Leaf = index + 1<<uint(depth)
+			if isSolved(&assignment) {
+				t.Fatal("aliased index accepted: ", numLeaves, index)
+			}
+		}
+	}
+
+	long := NewVarDepth(maxDepth)
+	if long.Assign(make([][]byte, maxDepth+2), 0, 1) == nil {
+		t.Fatal("proof longer than the circuit should not be assigned")
+	}
+}
+
+type arityCircuit struct {
+	M    ArityCircuit
+	Root frontend.Variable `gnark:",public"`
+}
+
+func (c *arityCircuit) Define(api frontend.API) error {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	c.M.VerifyProof(api, &h, c.Root)
+	return nil
+}
+
+func TestVerifyProofArity(t *testing.T) {
+	field := ecc.BN254.ScalarField()
+	fieldSize := len(field.Bytes())
+	numLeaves := 37
+
+	// 3 more leaves to fill the last node of every arity
+	var buf bytes.Buffer
+	for i := 0; i < numLeaves+3; i++ {
+		leaf, _ := rand.Int(rand.Reader, field)
+		buf.Write(leaf.FillBytes(make([]byte, fieldSize)))
+	}
+	data := buf.Bytes()[:numLeaves*fieldSize]
+
+	for _, arity := range []int{2, 4, 8} {
+		s, err := merkletree.BuildStoreArity(bytes.NewReader(data), merkletree.HashMiMCBN254, merkletree.DomainNone, fieldSize, arity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		depth := merkletree.TreeDepth(uint64(numLeaves), arity)
+
+		for _, index := range []uint64{0, 5, uint64(numLeaves - 1)} {
+			root, proofSet, _, err := s.Prove(index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			circuit := arityCircuit{M: NewArity(arity, depth)}
+			assignment := arityCircuit{M: NewArity(arity, depth)}
+			assignment.Root = root
+			assignment.M.Leaf = index
+			assignment.M.NumLeaves = numLeaves
+			for i := range assignment.M.Path {
+				assignment.M.Path[i] = proofSet[i]
+			}
+
+			if err := test.IsSolved(&circuit, &assignment, field); err != nil {
+				t.Fatal(err)
+			}
+
+			assignment.M.Leaf = (index + 1) % uint64(numLeaves)
+			if err := test.IsSolved(&circuit, &assignment, field); err == nil {
+				t.Fatal("proof accepted at another index: ", arity, index)
+			}
+
+			// the tree can't be claimed smaller than the depth of the circuit
+			assignment.M.Leaf = index
+			assignment.M.NumLeaves = 1
+			if err := test.IsSolved(&circuit, &assignment, field); err == nil {
+				t.Fatal("proof accepted for a shallower tree: ", arity, index)
+			}
+		}
+
+		// the copies filling the last node of a level share the path of the
+		// last leaf, but their index is not below NumLeaves
+		root, proofSet, _, _ := s.Prove(uint64(numLeaves - 1))
+		circuit := arityCircuit{M: NewArity(arity, depth)}
+		assignment := arityCircuit{M: NewArity(arity, depth)}
+		assignment.Root = root
+		assignment.M.Leaf = numLeaves
+		assignment.M.NumLeaves = numLeaves
+		for i := range assignment.M.Path {
+			assignment.M.Path[i] = proofSet[i]
+		}
+		if err := test.IsSolved(&circuit, &assignment, field); err == nil {
+			t.Fatal("proof accepted at the padding slot: ", arity)
+		}
+
+		// the last leaf of a larger tree whose last node is full doesn't
+		// prove a tree of numLeaves leaves
+		large, err := merkletree.BuildStoreArity(bytes.NewReader(buf.Bytes()), merkletree.HashMiMCBN254, merkletree.DomainNone, fieldSize, arity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, proofSet, _, _ = large.Prove(uint64(numLeaves - 1))
+		assignment.Root = root
+		assignment.M.Leaf = numLeaves - 1
+		for i := range assignment.M.Path {
+			assignment.M.Path[i] = proofSet[i]
+		}
+		if err := test.IsSolved(&circuit, &assignment, field); err == nil {
+			t.Fatal("proof accepted without padding: ", arity)
+		}
+		assignment.M.NumLeaves = numLeaves + 3
+		if err := test.IsSolved(&circuit, &assignment, field); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkVerifyProofArity reports the constraint count of one proof for the
+// tree sizes of acc (32 leaves) and test (1024 leaves).
+func BenchmarkVerifyProofArity(b *testing.B) {
+	for _, numLeaves := range []int{32, 1024} {
+		for _, arity := range []int{2, 4, 8} {
+			b.Run(fmt.Sprintf("leaves=%d/arity=%d", numLeaves, arity), func(b *testing.B) {
+				circuit := arityCircuit{M: NewArity(arity, merkletree.TreeDepth(uint64(numLeaves), arity))}
+				var nbConstraints int
+				for i := 0; i < b.N; i++ {
+					ccs, err := frontend.Compile(ecc.BW6_761.ScalarField(), r1cs.NewBuilder, &circuit)
+					if err != nil {
+						b.Fatal(err)
+					}
+					nbConstraints = ccs.GetNbConstraints()
+				}
+				b.ReportMetric(float64(nbConstraints), "constraints")
+			})
+		}
+	}
+}
+
+type consistencyCircuit struct {
+	C       ConsistencyCircuit
+	OldRoot frontend.Variable `gnark:",public"`
+	NewRoot frontend.Variable `gnark:",public"`
+}
+
+func (c *consistencyCircuit) Define(api frontend.API) error {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	c.C.VerifyProof(api, &h, c.OldRoot, c.NewRoot)
+	return nil
+}
+
+func TestVerifyConsistency(t *testing.T) {
+	field := ecc.BN254.ScalarField()
+	fieldSize := len(field.Bytes())
+	numLeaves := 21
+
+	var buf bytes.Buffer
+	for i := 0; i < numLeaves; i++ {
+		leaf, _ := rand.Int(rand.Reader, field)
+		buf.Write(leaf.FillBytes(make([]byte, fieldSize)))
+	}
+	s, err := merkletree.BuildStore(&buf, merkletree.HashMiMCBN254, merkletree.DomainNone, fieldSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sizes := range [][2]uint64{{1, 1}, {1, 21}, {5, 8}, {6, 13}, {8, 16}, {13, 21}, {21, 21}} {
+		oldRoot, _ := s.RootAt(sizes[0])
+		newRoot, _ := s.RootAt(sizes[1])
+		proof, err := s.ProveConsistency(sizes[0], sizes[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		circuit := consistencyCircuit{C: NewConsistency(sizes[0], sizes[1])}
+		assignment := consistencyCircuit{C: NewConsistency(sizes[0], sizes[1])}
+		assignment.OldRoot = oldRoot
+		assignment.NewRoot = newRoot
+		if len(proof) != len(assignment.C.Proof) {
+			t.Fatal("wrong consistency proof length: ", sizes)
+		}
+		for i := range assignment.C.Proof {
+			assignment.C.Proof[i] = proof[i]
+		}
+		if err := test.IsSolved(&circuit, &assignment, field); err != nil {
+			t.Fatal(err)
+		}
+
+		assignment.NewRoot = oldRoot
+		if sizes[0] != sizes[1] {
+			if err := test.IsSolved(&circuit, &assignment, field); err == nil {
+				t.Fatal("consistency accepted against another root: ", sizes)
+			}
+		}
+	}
+}
+
+type legacyCircuit struct {
+	M    LegacyCircuit
+	Root frontend.Variable `gnark:",public"`
+}
+
+func (c *legacyCircuit) Define(api frontend.API) error {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	c.M.VerifyProof(api, &h, c.Root)
+	return nil
+}
+
+func TestVerifyLegacyProof(t *testing.T) {
+	field := ecc.BN254.ScalarField()
+	fieldSize := len(field.Bytes())
+	const depth = 6
+
+	var buf bytes.Buffer
+	for i := 0; i < 1<<depth; i++ {
+		leaf, _ := rand.Int(rand.Reader, field)
+		buf.Write(leaf.FillBytes(make([]byte, fieldSize)))
+	}
+	data := buf.Bytes()
+
+	// one system for all tree sizes, solved directly as the test engine is
+	// too slow for thousands of witnesses.
+	ccs, err := frontend.Compile(field, r1cs.NewBuilder, &legacyCircuit{M: NewLegacy(depth)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	isSolved := func(assignment *legacyCircuit) error {
+		w, err := frontend.NewWitness(assignment, field)
+		if err != nil {
+			return err
+		}
+		return ccs.IsSolved(w)
+	}
+
+	for numLeaves := uint64(1); numLeaves <= 1<<depth; numLeaves++ {
+		for index := uint64(0); index < numLeaves; index++ {
+			r := bytes.NewReader(data[:int(numLeaves)*fieldSize])
+			root, proofSet, _, err := merkletree.Legacy_BuildReaderProof(r, hash.MIMC_BN254.New(), fieldSize, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !merkletree.Legacy_VerifyProof(hash.MIMC_BN254.New(), root, proofSet, index, numLeaves) {
+				t.Fatal("wrong native legacy proof: ", numLeaves, index)
+			}
+
+			assignment := legacyCircuit{M: NewLegacy(depth), Root: root}
+			if err := assignment.M.Assign(proofSet, index, numLeaves); err != nil {
+				t.Fatal(err)
+			}
+			if err := isSolved(&assignment); err != nil {
+				t.Fatal(numLeaves, index, err)
+			}
+
+			// legacy roots don't bind the leaf count, e.g. 3 and 4 leaves can
+			// share one, so other counts and indices must be judged as natively.
+			for _, other := range [][2]uint64{
+				{numLeaves - 1, index},
+				{numLeaves + 1, index},
+				{numLeaves, (index + 1) % numLeaves},
+				{numLeaves, index + 1},
+			} {
+				if other[0] == 0 || other[0] > 1<<depth || other == [2]uint64{numLeaves, index} {
+					continue
+				}
+				expected := merkletree.Legacy_VerifyProof(hash.MIMC_BN254.New(), root, proofSet, other[1], other[0])
+				assignment.M.Leaf = other[1]
+				assignment.M.NumLeaves = other[0]
+				err := isSolved(&assignment)
+				if (err == nil) != expected {
+					t.Fatal("circuit and native verifier disagree: ", numLeaves, index, other, err)
+				}
+			}
+		}
+	}
+}
+
+type batchCircuit struct {
+	B    BatchCircuit
+	Root frontend.Variable `gnark:",public"`
+}
+
+func (c *batchCircuit) Define(api frontend.API) error {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	c.B.VerifyProof(api, &h, c.Root)
+	return nil
+}
+
+// independentCircuit verifies the same leaves with one Circuit each.
+type independentCircuit struct {
+	M    []Circuit
+	Root frontend.Variable `gnark:",public"`
+}
+
+func (c *independentCircuit) Define(api frontend.API) error {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	for i := range c.M {
+		c.M[i].VerifyProof(api, &h, c.Root)
+	}
+	return nil
+}
+
+func TestVerifyBatch(t *testing.T) {
+	field := ecc.BN254.ScalarField()
+	fieldSize := len(field.Bytes())
+
+	for _, numLeaves := range []uint64{1, 21, 32} {
+		var buf bytes.Buffer
+		for i := uint64(0); i < numLeaves; i++ {
+			leaf, _ := rand.Int(rand.Reader, field)
+			buf.Write(leaf.FillBytes(make([]byte, fieldSize)))
+		}
+		data := buf.Bytes()
+
+		for _, k := range []int{1, 3, 8} {
+			if uint64(k) > numLeaves {
+				continue
+			}
+			// leaves spread over the tree, and side by side from the end
+			spread := make([]uint64, k)
+			packed := make([]uint64, k)
+			for i := range spread {
+				spread[i] = uint64(i) * numLeaves / uint64(k)
+				packed[i] = numLeaves - uint64(k) + uint64(i)
+			}
+			spread[k-1] = numLeaves - 1
+
+			for _, indices := range [][]uint64{spread, packed} {
+				root, _, mp, err := merkletree.BuildReaderMultiProof(bytes.NewReader(data), hash.MIMC_BN254.New(), fieldSize, indices)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				circuit := batchCircuit{B: NewBatch(k, numLeaves)}
+				assignment := batchCircuit{B: NewBatch(k, numLeaves), Root: root}
+				if err := assignment.B.Assign(hash.MIMC_BN254.New(), mp); err != nil {
+					t.Fatal(err)
+				}
+				if err := test.IsSolved(&circuit, &assignment, field); err != nil {
+					t.Fatal(numLeaves, indices, err)
+				}
+
+				// each leaf must reach its own known node of the shared level
+				if numLeaves > 1 {
+					assignment.B.Indices[0] = (indices[0] + 1) % numLeaves
+					if test.IsSolved(&circuit, &assignment, field) == nil {
+						t.Fatal("batch proof accepted at another index: ", numLeaves, indices)
+					}
+				}
+				assignment.B.Indices[0] = numLeaves
+				if test.IsSolved(&circuit, &assignment, field) == nil {
+					t.Fatal("batch proof accepted with an index out of range: ", numLeaves, indices)
+				}
+				assignment.B.Indices[0] = indices[0]
+				for j := range assignment.B.Known {
+					assignment.B.Known[j] = 0
+				}
+				if test.IsSolved(&circuit, &assignment, field) == nil {
+					t.Fatal("batch proof accepted without known nodes: ", numLeaves, indices)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkVerifyBatch reports the constraints of a batch proof of k leaves
+// of a 1024-leaf tree, and the share saved over k independent proofs.
+func BenchmarkVerifyBatch(b *testing.B) {
+	const numLeaves = 1024
+	for _, k := range []int{2, 16, 64} {
+		b.Run(fmt.Sprintf("k=%d", k), func(b *testing.B) {
+			batch := batchCircuit{B: NewBatch(k, numLeaves)}
+			independent := independentCircuit{M: make([]Circuit, k)}
+			for i := range independent.M {
+				independent.M[i] = New(merkletree.TreeDepth(numLeaves, 2))
+			}
+
+			var nbBatch, nbIndependent int
+			for i := 0; i < b.N; i++ {
+				ccs, err := frontend.Compile(ecc.BW6_761.ScalarField(), r1cs.NewBuilder, &batch)
+				if err != nil {
+					b.Fatal(err)
+				}
+				nbBatch = ccs.GetNbConstraints()
+
+				ccs, err = frontend.Compile(ecc.BW6_761.ScalarField(), r1cs.NewBuilder, &independent)
+				if err != nil {
+					b.Fatal(err)
+				}
+				nbIndependent = ccs.GetNbConstraints()
+			}
+			b.ReportMetric(float64(nbBatch), "constraints")
+			b.ReportMetric(float64(nbIndependent), "independent")
+			b.ReportMetric(100*float64(nbIndependent-nbBatch)/float64(nbIndependent), "%saved")
+		})
+	}
+}
+
+type binaryCircuit struct {
+	M      BinaryCircuit
+	Root   []uints.U8        `gnark:",public"`
+	Hash   merkletree.HashID `gnark:"-"`
+	Domain merkletree.Domain `gnark:"-"`
+}
+
+func (c *binaryCircuit) Define(api frontend.API) error {
+	h, err := NewBinaryHasher(api, c.Hash)
+	if err != nil {
+		return err
+	}
+	c.M.VerifyProof(api, WithBinaryDomain(h, c.Domain), c.Root)
+	return nil
+}
+
+func TestVerifyBinaryProof(t *testing.T) {
+	const segmentSize = 16
+	const numLeaves = 5
+	depth := merkletree.TreeDepth(uint64(numLeaves), 2)
+
+	for _, id := range []merkletree.HashID{merkletree.HashSHA256, merkletree.HashKeccak256} {
+		for _, d := range []merkletree.Domain{merkletree.DomainNone, merkletree.DomainRFC6962} {
+			data := make([]byte, numLeaves*segmentSize)
+			rand.Read(data)
+
+			// the last leaf of the odd tree is paired with itself
+			index := uint64(1)
+			if d == merkletree.DomainRFC6962 {
+				index = numLeaves - 1
+			}
+			h, _ := id.New()
+			root, proofSet, _, err := merkletree.BuildReaderProof(bytes.NewReader(data), merkletree.WithDomain(h, d), segmentSize, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			circuit := binaryCircuit{M: NewBinary(depth, segmentSize), Root: make([]uints.U8, len(root)), Hash: id, Domain: d}
+			assignment := binaryCircuit{M: NewBinary(depth, segmentSize), Root: uints.NewU8Array(root)}
+			if err := assignment.M.Assign(proofSet, index, numLeaves); err != nil {
+				t.Fatal(err)
+			}
+			err = test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField())
+			if err != nil {
+				t.Fatalf("%s %s, index %d: %v", id, d, index, err)
+			}
+
+			assignment.M.Data[0] = uints.NewU8(proofSet[0][0] ^ 1)
+			err = test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField())
+			if err == nil {
+				t.Fatalf("%s %s, index %d: wrong leaf accepted", id, d, index)
+			}
+
+			// the same word packed from bytes out of range
+			assignment.M.Data[0] = uints.U8{Val: int(proofSet[0][0]) - 1}
+			assignment.M.Data[1] = uints.U8{Val: int(proofSet[0][1]) + 256}
+			err = test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField())
+			if err == nil {
+				t.Fatalf("%s %s, index %d: byte out of range accepted", id, d, index)
+			}
+		}
+	}
+}
+
+func TestVerifyBinaryProofLast(t *testing.T) {
+	const segmentSize = 16
+	const numLeaves = 5
+	const lastSize = 7
+	depth := merkletree.TreeDepth(uint64(numLeaves), 2)
+
+	data := make([]byte, (numLeaves-1)*segmentSize+lastSize)
+	rand.Read(data)
+	h, _ := merkletree.HashSHA256.New()
+	root, proofSet, _, err := merkletree.BuildReaderProof(bytes.NewReader(data), h, segmentSize, numLeaves-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	circuit := binaryCircuit{M: NewBinaryLast(depth, segmentSize, lastSize), Root: make([]uints.U8, len(root)), Hash: merkletree.HashSHA256}
+	assignment := binaryCircuit{M: NewBinaryLast(depth, segmentSize, lastSize), Root: uints.NewU8Array(root)}
+	if err := assignment.M.Assign(proofSet, numLeaves-1, numLeaves); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a short leaf can't be claimed at another index
+	if err := assignment.M.Assign(proofSet, 1, numLeaves); err == nil {
+		t.Fatal("short leaf assigned to another index")
+	}
+	assignment.M.Leaf = 1
+	if err := test.IsSolved(&circuit, &assignment, ecc.BN254.ScalarField()); err == nil {
+		t.Fatal("short leaf accepted at another index")
+	}
+}
+
+type updateCircuit struct {
+	U         UpdateBatchCircuit
+	OldRoot   frontend.Variable `gnark:",public"`
+	NewRoot   frontend.Variable `gnark:",public"`
+	NumLeaves frontend.Variable `gnark:",public"`
+}
+
+func (c *updateCircuit) Define(api frontend.API) error {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(c.U.NumLeaves, c.NumLeaves)
+	c.U.VerifyProof(api, &h, c.OldRoot, c.NewRoot)
+	return nil
+}
+
+func TestVerifyUpdate(t *testing.T) {
+	mod := ecc.BN254.ScalarField()
+	fieldSize := len(mod.Bytes())
+	randLeaf := func() []byte {
+		x, _ := rand.Int(rand.Reader, mod)
+		return x.FillBytes(make([]byte, fieldSize))
+	}
+
+	for _, numLeaves := range []int{3, 7, 8} {
+		var buf bytes.Buffer
+		for i := 0; i < numLeaves; i++ {
+			buf.Write(randLeaf())
+		}
+		s, err := merkletree.BuildStore(&buf, merkletree.HashMiMCBN254, merkletree.DomainNone, fieldSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the last leaf is its own sibling when numLeaves is odd
+		indices := []uint64{uint64(numLeaves - 1), 0, uint64(numLeaves - 1)}
+		oldRoot := s.Root()
+		proofs := make([]*merkletree.UpdateProof, len(indices))
+		for k, i := range indices {
+			_, proofs[k], err = s.UpdateLeaf(i, randLeaf())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		depth := merkletree.TreeDepth(uint64(numLeaves), 2)
+		assignment := updateCircuit{U: NewUpdateBatch(len(indices), depth), OldRoot: oldRoot, NewRoot: s.Root(), NumLeaves: numLeaves}
+		if err := assignment.U.Assign(proofs); err != nil {
+			t.Fatal(err)
+		}
+		err = test.IsSolved(&updateCircuit{U: NewUpdateBatch(len(indices), depth)}, &assignment, ecc.BN254.ScalarField())
+		if err != nil {
+			t.Fatal(numLeaves, err)
+		}
+
+		assignment.NewRoot = proofs[1].NewRoot
+		err = test.IsSolved(&updateCircuit{U: NewUpdateBatch(len(indices), depth)}, &assignment, ecc.BN254.ScalarField())
+		if err == nil {
+			t.Fatal(numLeaves, "wrong new root accepted")
+		}
+	}
+}
+
+func TestVerifyUpdatePadding(t *testing.T) {
+	const numLeaves = 5
+	mod := ecc.BN254.ScalarField()
+	fieldSize := len(mod.Bytes())
+	randLeaf := func() []byte {
+		x, _ := rand.Int(rand.Reader, mod)
+		return x.FillBytes(make([]byte, fieldSize))
+	}
+
+	// the last leaf of an odd tree is its own sibling, so the tree with the
+	// last leaf repeated has the same root, and updating its padding slot
+	// appends a leaf
+	var buf bytes.Buffer
+	for i := 0; i < numLeaves; i++ {
+		buf.Write(randLeaf())
+	}
+	s, err := merkletree.BuildStore(bytes.NewReader(buf.Bytes()), merkletree.HashMiMCBN254, merkletree.DomainNone, fieldSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(buf.Bytes()[(numLeaves-1)*fieldSize:])
+	padded, err := merkletree.BuildStore(&buf, merkletree.HashMiMCBN254, merkletree.DomainNone, fieldSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s.Root(), padded.Root()) {
+		t.Fatal("padded tree has another root")
+	}
+	_, proof, err := padded.UpdateLeaf(numLeaves, randLeaf())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(publicSize uint64, ok bool) {
+		depth := merkletree.TreeDepth(numLeaves, 2)
+		assignment := updateCircuit{U: NewUpdateBatch(1, depth), OldRoot: proof.OldRoot, NewRoot: proof.NewRoot, NumLeaves: publicSize}
+		if err := assignment.U.Assign([]*merkletree.UpdateProof{proof}); err != nil {
+			t.Fatal(err)
+		}
+		err := test.IsSolved(&updateCircuit{U: NewUpdateBatch(1, depth)}, &assignment, mod)
+		if (err == nil) != ok {
+			t.Fatal(publicSize, err)
+		}
+	}
+	check(numLeaves+1, true)
+	check(numLeaves, false)
+}
+
+type mmrCircuit struct {
+	M    MMRCircuit
+	Root frontend.Variable `gnark:",public"`
+}
+
+func (c *mmrCircuit) Define(api frontend.API) error {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	c.M.VerifyProof(api, &h, c.Root)
+	return nil
+}
+
+func TestVerifyMMR(t *testing.T) {
+	mod := ecc.BN254.ScalarField()
+	fieldSize := len(mod.Bytes())
+
+	m := merkletree.NewMMR(hash.MIMC_BN254.New())
+	var leaves [][]byte
+	for _, numLeaves := range []uint64{1, 6, 13, 16} {
+		for uint64(len(leaves)) < numLeaves {
+			x, _ := rand.Int(rand.Reader, mod)
+			leaves = append(leaves, x.FillBytes(make([]byte, fieldSize)))
+			m.Append(leaves[len(leaves)-1])
+		}
+
+		ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &mmrCircuit{M: NewMMR(numLeaves)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		solve := func(p *merkletree.MMRProof, root []byte) error {
+			assignment := mmrCircuit{M: NewMMR(numLeaves), Root: root}
+			if err := assignment.M.Assign(p); err != nil {
+				return err
+			}
+			w, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
+			if err != nil {
+				return err
+			}
+			return ccs.IsSolved(w)
+		}
+
+		peaks, _ := m.Peaks(numLeaves)
+		root := merkletree.BagPeaks(hash.MIMC_BN254.New(), peaks)
+		for i := uint64(0); i < numLeaves; i++ {
+			p, err := m.Prove(i, leaves[i], numLeaves)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := solve(p, root); err != nil {
+				t.Fatal(numLeaves, i, err)
+			}
+
+			x, _ := rand.Int(rand.Reader, mod)
+			p.Leaf = x.Bytes()
+			if solve(p, root) == nil {
+				t.Fatal(numLeaves, i, "wrong leaf accepted")
+			}
+		}
+
+		p, _ := m.Prove(numLeaves-1, leaves[numLeaves-1], numLeaves)
+		p.Index = numLeaves
+		if solve(p, root) == nil {
+			t.Fatal(numLeaves, "index out of range accepted")
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package merklecircuit
+
+import (
+	mbits "math/bits"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash"
+	"github.com/yydfjt/gnark-example/lib/merkletree"
+)
+
+// ConsistencyCircuit verifies a merkletree consistency proof showing that the
+// tree of NewSize leaves extends the tree of OldSize leaves. The sizes are
+// fixed when the circuit is compiled, Proof is allocated by NewConsistency.
+type ConsistencyCircuit struct {
+	Proof   []frontend.Variable
+	OldSize uint64 `gnark:"-"`
+	NewSize uint64 `gnark:"-"`
+}
+
+// NewConsistency allocates a circuit for the given tree sizes.
+func NewConsistency(oldSize, newSize uint64) ConsistencyCircuit {
+	if oldSize == 0 || oldSize > newSize {
+		panic("invalid tree sizes")
+	}
+
+	n := mbits.OnesCount64(oldSize)
+	height := mbits.TrailingZeros64(oldSize)
+	p := (oldSize >> uint(height)) - 1
+	for ; height < merkletree.TreeDepth(newSize, 2); height++ {
+		if p%2 == 0 && p+1 < merkletree.LevelWidth(newSize, 2, height) {
+			n++
+		}
+		p /= 2
+	}
+
+	return ConsistencyCircuit{
+		Proof:   make([]frontend.Variable, n),
+		OldSize: oldSize,
+		NewSize: newSize,
+	}
+}
+
+// walk folds the peaks up to the root of the tree of size leaves, taking
+// the right siblings from hashes.
+func (c *ConsistencyCircuit) walk(api frontend.API, h hash.FieldHasher, size uint64, peaks, hashes []frontend.Variable) frontend.Variable {
+	height := mbits.TrailingZeros64(c.OldSize)
+	p := (c.OldSize >> uint(height)) - 1
+	next := len(peaks) - 1
+
+	sum := peaks[next]
+	for ; height < merkletree.TreeDepth(size, 2); height++ {
+		if p%2 == 1 {
+			next--
+			sum = nodeSum(api, h, peaks[next], sum)
+		} else if p+1 < merkletree.LevelWidth(size, 2, height) {
+			sum = nodeSum(api, h, sum, hashes[0])
+			hashes = hashes[1:]
+		} else {
+			sum = nodeSum(api, h, sum, sum)
+		}
+		p /= 2
+	}
+	return sum
+}
+
+// VerifyProof asserts that Proof links oldRoot to newRoot.
+func (c *ConsistencyCircuit) VerifyProof(api frontend.API, h hash.FieldHasher, oldRoot, newRoot frontend.Variable) {
+	npeaks := mbits.OnesCount64(c.OldSize)
+	peaks, hashes := c.Proof[:npeaks], c.Proof[npeaks:]
+
+	api.AssertIsEqual(c.walk(api, h, c.OldSize, peaks, nil), oldRoot)
+	api.AssertIsEqual(c.walk(api, h, c.NewSize, peaks, hashes), newRoot)
+}
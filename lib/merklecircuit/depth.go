@@ -0,0 +1,79 @@
+package merklecircuit
+
+import (
+	"errors"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash"
+)
+
+// VarDepthCircuit verifies proofs of trees of any depth up to the one it was
+// allocated for with NewVarDepth, so that one compiled circuit serves trees
+// of many sizes. Depth is the depth of the tree of NumLeaves leaves, Path
+// holds the leaf and Depth siblings, and its unused tail is assigned 0.
+type VarDepthCircuit struct {
+	Leaf      frontend.Variable
+	NumLeaves frontend.Variable
+	Depth     frontend.Variable
+	Path      []frontend.Variable
+}
+
+// NewVarDepth allocates a circuit for trees of at most maxDepth levels.
+func NewVarDepth(maxDepth int) VarDepthCircuit {
+	if maxDepth <= 0 {
+		panic("invalid tree depth")
+	}
+	return VarDepthCircuit{
+		Path: make([]frontend.Variable, maxDepth+1),
+	}
+}
+
+// Assign sets a proof returned by merkletree.BuildReaderProof.
+func (mp *VarDepthCircuit) Assign(proofSet [][]byte, index, numLeaves uint64) error {
+	if err := assignPath(mp.Path, proofSet); err != nil {
+		return err
+	}
+	mp.Leaf = index
+	mp.NumLeaves = numLeaves
+	mp.Depth = len(proofSet) - 1
+	return nil
+}
+
+var errProofSize = errors.New("proof doesn't fit the circuit")
+
+// assignPath copies proofSet to the head of path and zeroes the tail.
+func assignPath(path []frontend.Variable, proofSet [][]byte) error {
+	if len(proofSet) == 0 || len(proofSet) > len(path) {
+		return errProofSize
+	}
+	for i := range path {
+		if i < len(proofSet) {
+			path[i] = proofSet[i]
+		} else {
+			path[i] = 0
+		}
+	}
+	return nil
+}
+
+// VerifyProof asserts that the first element of Path is the leaf at index
+// Leaf of the tree of NumLeaves leaves with the given root, which must have
+// Depth levels. Like Circuit.VerifyProof, the index is canonical.
+func (mp *VarDepthCircuit) VerifyProof(api frontend.API, h hash.FieldHasher, root frontend.Variable) {
+	maxDepth := len(mp.Path) - 1
+
+	// active[k] is 1 while k <= Depth
+	binLeaf, eq, active := canonicalIndex(api, mp.Leaf, mp.NumLeaves, mp.Depth, maxDepth)
+
+	sum := leafSum(api, h, mp.Path[0])
+	for i := 1; i <= maxDepth; i++ {
+		assertPadding(api, api.Mul(active[i], eq[i-1]), binLeaf[i-1], mp.Path[i], sum)
+
+		d1 := api.Select(binLeaf[i-1], mp.Path[i], sum)
+		d2 := api.Select(binLeaf[i-1], sum, mp.Path[i])
+		sum = api.Select(active[i], nodeSum(api, h, d1, d2), sum)
+	}
+
+	// Compare our calculated Merkle root to the desired Merkle root.
+	api.AssertIsEqual(sum, root)
+}
@@ -0,0 +1,39 @@
+package merklecircuit
+
+import (
+	"errors"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash"
+	"github.com/consensys/gnark/std/hash/mimc"
+	"github.com/yydfjt/gnark-example/lib/merkletree"
+	"github.com/yydfjt/gnark-example/lib/poseidon2circuit"
+)
+
+// NewHasher returns the circuit counterpart of the native hash id, which must
+// be defined over the field of api. It lets a circuit pick its hash the same
+// way the tree it verifies was built.
+func NewHasher(api frontend.API, id merkletree.HashID) (hash.FieldHasher, error) {
+	curve, err := id.Curve()
+	if err != nil {
+		return nil, err
+	}
+	if api.Compiler().Field().Cmp(curve.ScalarField()) != 0 {
+		return nil, errors.New("hash is defined over another field")
+	}
+
+	switch id {
+	case merkletree.HashPoseidon2BN254, merkletree.HashPoseidon2BLS12377:
+		h, err := poseidon2circuit.NewPoseidon2(api)
+		if err != nil {
+			return nil, err
+		}
+		return &h, nil
+	default:
+		h, err := mimc.NewMiMC(api)
+		if err != nil {
+			return nil, err
+		}
+		return &h, nil
+	}
+}
@@ -0,0 +1,98 @@
+package merklecircuit
+
+import (
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash"
+)
+
+// LegacyCircuit verifies the proofs of merkletree.Legacy_Prove. Those trees
+// are not padded: a tree of NumLeaves leaves is a list of perfect subtrees,
+// one per bit of NumLeaves, the smaller ones being folded into the larger
+// ones on their left. The proof length depends on NumLeaves and Leaf, so Path
+// is allocated by NewLegacy for the largest tree and the unused tail is
+// assigned 0.
+type LegacyCircuit struct {
+	Leaf      frontend.Variable
+	NumLeaves frontend.Variable
+	Path      []frontend.Variable
+}
+
+// NewLegacy allocates a circuit for trees of at most 1<<depth leaves.
+func NewLegacy(depth int) LegacyCircuit {
+	if depth <= 0 {
+		panic("invalid tree depth")
+	}
+	return LegacyCircuit{
+		Path: make([]frontend.Variable, depth+1),
+	}
+}
+
+// Assign sets a proof returned by merkletree.Legacy_Prove.
+func (mp *LegacyCircuit) Assign(proofSet [][]byte, index, numLeaves uint64) error {
+	if err := assignPath(mp.Path, proofSet); err != nil {
+		return err
+	}
+	mp.Leaf = index
+	mp.NumLeaves = numLeaves
+	return nil
+}
+
+// VerifyProof asserts that the first element of Path is the leaf at index
+// Leaf of the legacy tree of NumLeaves leaves with the given root.
+func (mp *LegacyCircuit) VerifyProof(api frontend.API, h hash.FieldHasher, root frontend.Variable) {
+	depth := len(mp.Path) - 1
+	binLeaf := api.ToBinary(mp.Leaf, depth+1)
+	binNum := api.ToBinary(mp.NumLeaves, depth+1)
+
+	// The leaf belongs to the perfect subtree of height top, the highest bit
+	// where Leaf and NumLeaves differ. inSub[k] is 1 while k <= top.
+	inSub := make([]frontend.Variable, depth+2)
+	inSub[depth+1] = 0
+	for k := depth; k >= 0; k-- {
+		inSub[k] = api.Or(api.Xor(binLeaf[k], binNum[k]), inSub[k+1])
+	}
+
+	// Leaf < NumLeaves: the bits differ and Leaf has a 0 at the highest one.
+	api.AssertIsEqual(inSub[0], 1)
+	var leafTop frontend.Variable = 0
+	for k := 0; k <= depth; k++ {
+		leafTop = api.Add(leafTop, api.Mul(api.Sub(inSub[k], inSub[k+1]), binLeaf[k]))
+	}
+	api.AssertIsEqual(leafTop, 0)
+
+	// top siblings within the subtree, one right sibling folding the smaller
+	// subtrees if there are any, and a left sibling per larger subtree.
+	var top, lower, larger frontend.Variable = 0, 0, 0
+	for k := 0; k <= depth; k++ {
+		if k > 0 {
+			top = api.Add(top, inSub[k])
+		}
+		lower = api.Add(lower, api.Mul(binNum[k], inSub[k+1]))
+		larger = api.Add(larger, api.Mul(binNum[k], api.Sub(1, inSub[k])))
+	}
+	right := api.Sub(1, api.IsZero(lower))
+	length := api.Add(top, right, larger)
+
+	// active[k] is 1 while k <= length, which must not exceed depth.
+	active := make([]frontend.Variable, depth+2)
+	active[depth+1] = 0
+	for k := depth; k >= 0; k-- {
+		active[k] = api.Add(active[k+1], api.IsZero(api.Sub(length, k)))
+	}
+	api.AssertIsEqual(active[0], 1)
+
+	sum := leafSum(api, h, mp.Path[0])
+	for k := 1; k <= depth; k++ {
+		// the node is on the left within the subtree if its index bit is 0,
+		// and on the left of the folded smaller subtrees.
+		first := api.Sub(inSub[k-1], inSub[k])
+		left := api.Add(api.Mul(inSub[k], api.Sub(1, binLeaf[k-1])), api.Mul(first, right))
+
+		d1 := api.Select(left, sum, mp.Path[k])
+		d2 := api.Select(left, mp.Path[k], sum)
+		sum = api.Select(active[k], nodeSum(api, h, d1, d2), sum)
+	}
+
+	// Compare our calculated Merkle root to the desired Merkle root.
+	api.AssertIsEqual(sum, root)
+}
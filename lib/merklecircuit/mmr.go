@@ -0,0 +1,98 @@
+package merklecircuit
+
+import (
+	mbits "math/bits"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash"
+	"github.com/yydfjt/gnark-example/lib/merkletree"
+)
+
+// MMRCircuit verifies a merkletree.MMRProof in the Merkle Mountain Range of
+// NumLeaves leaves, which is fixed when the circuit is compiled. Path holds
+// the leaf and the siblings up to the peak of its mountain, padded with 0 to
+// the height of the highest mountain, and Peaks holds all peaks. The slices
+// are allocated by NewMMR.
+type MMRCircuit struct {
+	Leaf      frontend.Variable
+	Path      []frontend.Variable
+	Peaks     []frontend.Variable
+	NumLeaves uint64 `gnark:"-"`
+}
+
+// NewMMR allocates a circuit for the range of numLeaves leaves.
+func NewMMR(numLeaves uint64) MMRCircuit {
+	if numLeaves == 0 {
+		panic("empty mountain range")
+	}
+	return MMRCircuit{
+		Path:      make([]frontend.Variable, mbits.Len64(numLeaves)),
+		Peaks:     make([]frontend.Variable, mbits.OnesCount64(numLeaves)),
+		NumLeaves: numLeaves,
+	}
+}
+
+// Assign sets a proof returned by merkletree.MMR.Prove.
+func (c *MMRCircuit) Assign(p *merkletree.MMRProof) error {
+	if p.NumLeaves != c.NumLeaves || len(p.Peaks) != len(c.Peaks) {
+		return errProofSize
+	}
+	proofSet := append([][]byte{p.Leaf}, p.Path...)
+	if err := assignPath(c.Path, proofSet); err != nil {
+		return err
+	}
+	c.Leaf = p.Index
+	for j := range p.Peaks {
+		c.Peaks[j] = p.Peaks[j]
+	}
+	return nil
+}
+
+// VerifyProof asserts that the first element of Path is the leaf at index
+// Leaf of the range with the given root.
+func (c *MMRCircuit) VerifyProof(api frontend.API, h hash.FieldHasher, root frontend.Variable) {
+	n := c.NumLeaves
+	nbBits := mbits.Len64(n)
+	binLeaf := api.ToBinary(c.Leaf, nbBits)
+
+	// eq[k] is 1 if Leaf and NumLeaves have the same bits from k up
+	eq := make([]frontend.Variable, nbBits+1)
+	eq[nbBits] = 1
+	for k := nbBits - 1; k >= 0; k-- {
+		if (n>>uint(k))&1 == 1 {
+			eq[k] = api.Mul(eq[k+1], binLeaf[k])
+		} else {
+			eq[k] = api.Mul(eq[k+1], api.Sub(1, binLeaf[k]))
+		}
+	}
+
+	// the mountain of the leaf has the height of the highest differing bit,
+	// which must be set in NumLeaves for Leaf to be below it
+	api.AssertIsEqual(eq[0], 0)
+	var peak frontend.Variable = 0
+	for k := 0; k < nbBits; k++ {
+		isHeight := api.Sub(eq[k+1], eq[k])
+		if (n>>uint(k))&1 == 1 {
+			peak = api.Add(peak, api.Mul(isHeight, c.Peaks[mbits.OnesCount64(n>>uint(k+1))]))
+		} else {
+			api.AssertIsEqual(isHeight, 0)
+		}
+	}
+
+	sum := leafSum(api, h, c.Path[0])
+	for k := 1; k < len(c.Path); k++ {
+		// levels at and above the height of the mountain are skipped
+		d1 := api.Select(binLeaf[k-1], c.Path[k], sum)
+		d2 := api.Select(binLeaf[k-1], sum, c.Path[k])
+		sum = api.Select(eq[k], sum, nodeSum(api, h, d1, d2))
+	}
+	api.AssertIsEqual(sum, peak)
+
+	bagged := c.Peaks[len(c.Peaks)-1]
+	for j := len(c.Peaks) - 2; j >= 0; j-- {
+		bagged = nodeSum(api, h, c.Peaks[j], bagged)
+	}
+
+	// Compare our calculated root to the desired root.
+	api.AssertIsEqual(bagged, root)
+}
@@ -0,0 +1,137 @@
+package merklecircuit
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash"
+	"github.com/yydfjt/gnark-example/lib/merkletree"
+)
+
+// UpdateCircuit verifies a merkletree.UpdateProof of a binary tree: the leaf
+// at index Leaf of the tree of NumLeaves leaves goes from OldLeaf to NewLeaf,
+// which turns the old root into the new one. Path holds the siblings and is
+// allocated by NewUpdate. NumLeaves must be bound by the caller, see
+// Circuit.NumLeaves.
+type UpdateCircuit struct {
+	Leaf      frontend.Variable
+	NumLeaves frontend.Variable
+	OldLeaf   frontend.Variable
+	NewLeaf   frontend.Variable
+	Path      []frontend.Variable
+}
+
+// NewUpdate allocates a circuit for trees of depth levels.
+func NewUpdate(depth int) UpdateCircuit {
+	if depth < 0 {
+		panic("invalid tree depth")
+	}
+	return UpdateCircuit{
+		Path: make([]frontend.Variable, depth),
+	}
+}
+
+// Assign sets a proof returned by merkletree.Store.UpdateLeaf.
+func (c *UpdateCircuit) Assign(p *merkletree.UpdateProof) error {
+	if p.Arity != 2 || len(p.Path) != len(c.Path) {
+		return errProofSize
+	}
+	c.Leaf = p.Index
+	c.NumLeaves = p.NumLeaves
+	c.OldLeaf = p.OldLeaf
+	c.NewLeaf = p.NewLeaf
+	for i := range p.Path {
+		c.Path[i] = p.Path[i]
+	}
+	return nil
+}
+
+// VerifyProof asserts that the update turns oldRoot into newRoot. The index
+// is canonical as in Circuit.VerifyProof. A node without sibling is paired
+// with itself, so at those levels the new path uses the new node instead of
+// the sibling given for the old one.
+func (c *UpdateCircuit) VerifyProof(api frontend.API, h hash.FieldHasher, oldRoot, newRoot frontend.Variable) {
+	depth := len(c.Path)
+
+	binLeaf, eq, _ := canonicalIndex(api, c.Leaf, c.NumLeaves, depth, depth)
+
+	oldSum := leafSum(api, h, c.OldLeaf)
+	newSum := leafSum(api, h, c.NewLeaf)
+	for i, sibling := range c.Path {
+		alone := api.Mul(eq[i], api.Sub(1, binLeaf[i]))
+		api.AssertIsEqual(api.Mul(alone, api.Sub(sibling, oldSum)), 0)
+		newSibling := api.Select(alone, newSum, sibling)
+
+		d1 := api.Select(binLeaf[i], sibling, oldSum)
+		d2 := api.Select(binLeaf[i], oldSum, sibling)
+		oldSum = nodeSum(api, h, d1, d2)
+
+		d1 = api.Select(binLeaf[i], newSibling, newSum)
+		d2 = api.Select(binLeaf[i], newSum, newSibling)
+		newSum = nodeSum(api, h, d1, d2)
+	}
+
+	api.AssertIsEqual(oldSum, oldRoot)
+	api.AssertIsEqual(newSum, newRoot)
+}
+
+// UpdateBatchCircuit verifies a sequence of updates of the same tree, each
+// one applied to the root left by the previous one. Roots holds the roots
+// between the updates, so that only the first and the last have to be
+// public. Every update is bound to the size NumLeaves, which the caller must
+// bind in turn, see Circuit.NumLeaves.
+type UpdateBatchCircuit struct {
+	Updates   []UpdateCircuit
+	Roots     []frontend.Variable
+	NumLeaves frontend.Variable
+}
+
+// NewUpdateBatch allocates a circuit for k updates of a tree of depth levels.
+func NewUpdateBatch(k, depth int) UpdateBatchCircuit {
+	if k <= 0 {
+		panic("invalid batch size")
+	}
+	c := UpdateBatchCircuit{
+		Updates: make([]UpdateCircuit, k),
+		Roots:   make([]frontend.Variable, k-1),
+	}
+	for i := range c.Updates {
+		c.Updates[i] = NewUpdate(depth)
+	}
+	return c
+}
+
+// Assign sets the proofs returned by successive calls to
+// merkletree.Store.UpdateLeaf.
+func (c *UpdateBatchCircuit) Assign(proofs []*merkletree.UpdateProof) error {
+	if len(proofs) != len(c.Updates) {
+		return errors.New("batch size doesn't match the circuit")
+	}
+	for i, p := range proofs {
+		if i > 0 && (!bytes.Equal(proofs[i-1].NewRoot, p.OldRoot) || p.NumLeaves != proofs[0].NumLeaves) {
+			return errors.New("updates don't follow each other")
+		}
+		if err := c.Updates[i].Assign(p); err != nil {
+			return err
+		}
+		if i > 0 {
+			c.Roots[i-1] = p.OldRoot
+		}
+	}
+	c.NumLeaves = proofs[0].NumLeaves
+	return nil
+}
+
+// VerifyProof asserts that the updates of the tree of NumLeaves leaves turn
+// oldRoot into newRoot.
+func (c *UpdateBatchCircuit) VerifyProof(api frontend.API, h hash.FieldHasher, oldRoot, newRoot frontend.Variable) {
+	roots := make([]frontend.Variable, 0, len(c.Updates)+1)
+	roots = append(roots, oldRoot)
+	roots = append(roots, c.Roots...)
+	roots = append(roots, newRoot)
+	for i := range c.Updates {
+		api.AssertIsEqual(c.Updates[i].NumLeaves, c.NumLeaves)
+		c.Updates[i].VerifyProof(api, h, roots[i], roots[i+1])
+	}
+}
@@ -0,0 +1,64 @@
+package merkletree
+
+import (
+	"bytes"
+	"hash"
+)
+
+// TreeDepth returns the number of levels above the leaves of a tree whose
+// nodes have arity children.
+func TreeDepth(numLeaves uint64, arity int) int {
+	depth := 0
+	for width := numLeaves; width > 1; width = (width + uint64(arity) - 1) / uint64(arity) {
+		depth++
+	}
+	return depth
+}
+
+// LevelWidth returns the number of nodes at the given height. The missing
+// children of the last node of a level are filled with its last child, which
+// for binary trees pairs an odd node with itself.
+func LevelWidth(numLeaves uint64, arity int, height int) uint64 {
+	width := numLeaves
+	for i := 0; i < height; i++ {
+		width = (width + uint64(arity) - 1) / uint64(arity)
+	}
+	return width
+}
+
+// nodeSumN returns the hash of the children of a node. It equals nodeSum for
+// two children.
+func nodeSumN(h hash.Hash, children [][]byte) []byte {
+	data := make([][]byte, 0, len(children)+1)
+	data = append(data, prefix(h, nodeTag))
+	data = append(data, children...)
+	return sum(h, data...)
+}
+
+// VerifyProofArity verifies a proof of a tree whose nodes have arity
+// children, as returned by Store.Prove. After the leaf, the proof set holds
+// for every level the arity-1 siblings of the node, from left to right. It is
+// the same as VerifyProof for binary trees and, like it, doesn't know the
+// size of the tree: the copies filling the last node of a level let several
+// indices share a path. Use VerifySizedProofArity when the index must be
+// canonical.
+func VerifyProofArity(h hash.Hash, arity int, merkleRoot []byte, proofSet [][]byte, proofIndex uint64) bool {
+	if arity < 2 || len(proofSet) == 0 || (len(proofSet)-1)%(arity-1) != 0 {
+		return false
+	}
+
+	sum := leafSum(h, proofSet[0])
+	children := make([][]byte, 0, arity)
+	for i := 1; i < len(proofSet); i += arity - 1 {
+		pos := int(proofIndex % uint64(arity))
+		proofIndex /= uint64(arity)
+
+		children = children[:0]
+		children = append(children, proofSet[i:i+pos]...)
+		children = append(children, sum)
+		children = append(children, proofSet[i+pos:i+arity-1]...)
+		sum = nodeSumN(h, children)
+	}
+
+	return bytes.Equal(sum, merkleRoot)
+}
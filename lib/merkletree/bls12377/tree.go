@@ -0,0 +1,29 @@
+// Package bls12377 provides Merkle trees over the scalar field of BLS12-377, hashed
+// with the MiMC of that field.
+package bls12377
+
+import (
+	"github.com/consensys/gnark-crypto/ecc/bls12-377/fr"
+	"github.com/consensys/gnark-crypto/ecc/bls12-377/fr/mimc"
+	"github.com/yydfjt/gnark-example/lib/merkletree"
+)
+
+// Proof can be assigned to merklecircuit.Circuit with merklecircuit.Assign.
+type Proof = merkletree.FieldProof[fr.Element]
+
+func Root(leaves []fr.Element) (fr.Element, error) {
+	return merkletree.FieldRoot(mimc.NewMiMC(), leaves)
+}
+
+func BuildProof(leaves []fr.Element, index uint64) (Proof, error) {
+	return merkletree.BuildFieldProof(mimc.NewMiMC(), leaves, index)
+}
+
+// BuildMultiProof returns the proofs of all indices, hashing the tree once.
+func BuildMultiProof(leaves []fr.Element, indices []uint64) ([]Proof, error) {
+	return merkletree.BuildFieldMultiProof(mimc.NewMiMC(), leaves, indices)
+}
+
+func VerifyProof(p Proof) bool {
+	return merkletree.VerifyFieldProof(mimc.NewMiMC(), p)
+}
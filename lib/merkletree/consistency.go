@@ -0,0 +1,123 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	mbits "math/bits"
+)
+
+// A consistency proof shows that the tree of newSize leaves extends the tree
+// of oldSize leaves. The complete subtrees of the old tree, one per set bit
+// of oldSize, are also nodes of the new tree. The proof lists their roots
+// (the peaks, from the left) followed by the right siblings met on the path
+// from the smallest peak up to the new root. Folding the peaks with the
+// padding of the old tree gives the old root, and walking the path with the
+// siblings gives the new one. Siblings that are duplicates of the node, as
+// padded by joinAndFillSubTrees, are left out.
+
+// subtreeNode returns the i-th node at the given height of the tree of the
+// first size leaves of the store.
+func (s *Store) subtreeNode(size uint64, height int, i uint64) []byte {
+	if (i+1)<<uint(height) <= size || height == 0 {
+		return s.node(height, i)
+	}
+	left := s.subtreeNode(size, height-1, 2*i)
+	if 2*i+1 >= LevelWidth(size, 2, height-1) {
+		return nodeSum(s.hash, left, left)
+	}
+	return nodeSum(s.hash, left, s.subtreeNode(size, height-1, 2*i+1))
+}
+
+// RootAt returns the root the tree had when it held size leaves.
+func (s *Store) RootAt(size uint64) ([]byte, error) {
+	if s.arity != 2 {
+		return nil, errors.New("only binary trees are supported")
+	}
+	if size == 0 || size > s.numLeaves {
+		return nil, errors.New("tree size out of range")
+	}
+	return s.subtreeNode(size, TreeDepth(size, 2), 0), nil
+}
+
+// ProveConsistency returns a proof that the tree of newSize leaves extends the
+// tree of oldSize leaves.
+func (s *Store) ProveConsistency(oldSize, newSize uint64) ([][]byte, error) {
+	if s.arity != 2 {
+		return nil, errors.New("only binary trees are supported")
+	}
+	if oldSize == 0 || oldSize > newSize || newSize > s.numLeaves {
+		return nil, errors.New("tree size out of range")
+	}
+
+	var proof [][]byte
+	for height := 63; height >= 0; height-- {
+		if oldSize&(1<<uint(height)) != 0 {
+			i := (oldSize >> uint(height)) - 1
+			proof = append(proof, append([]byte(nil), s.node(height, i)...))
+		}
+	}
+
+	height := mbits.TrailingZeros64(oldSize)
+	p := (oldSize >> uint(height)) - 1
+	for ; height < TreeDepth(newSize, 2); height++ {
+		if p%2 == 0 && p+1 < LevelWidth(newSize, 2, height) {
+			proof = append(proof, s.subtreeNode(newSize, height, p+1))
+		}
+		p /= 2
+	}
+
+	return proof, nil
+}
+
+// walkConsistency folds the peaks of oldSize up to the root of the tree of
+// size leaves, taking the right siblings from hashes. It returns the root
+// and the hashes left.
+func walkConsistency(h hash.Hash, oldSize, size uint64, peaks, hashes [][]byte) ([]byte, [][]byte, bool) {
+	height := mbits.TrailingZeros64(oldSize)
+	p := (oldSize >> uint(height)) - 1
+	next := len(peaks) - 1
+
+	sum := peaks[next]
+	for ; height < TreeDepth(size, 2); height++ {
+		if p%2 == 1 {
+			next--
+			sum = nodeSum(h, peaks[next], sum)
+		} else if p+1 < LevelWidth(size, 2, height) {
+			if len(hashes) == 0 {
+				return nil, nil, false
+			}
+			sum = nodeSum(h, sum, hashes[0])
+			hashes = hashes[1:]
+		} else {
+			sum = nodeSum(h, sum, sum)
+		}
+		p /= 2
+	}
+
+	return sum, hashes, next == 0
+}
+
+// VerifyConsistency returns true if proof shows that the tree with newRoot
+// and newSize leaves extends the tree with oldRoot and oldSize leaves.
+func VerifyConsistency(h hash.Hash, oldSize, newSize uint64, oldRoot, newRoot []byte, proof [][]byte) bool {
+	if oldSize == 0 || oldSize > newSize {
+		return false
+	}
+	npeaks := mbits.OnesCount64(oldSize)
+	if len(proof) < npeaks {
+		return false
+	}
+	peaks, hashes := proof[:npeaks], proof[npeaks:]
+
+	root, rest, ok := walkConsistency(h, oldSize, oldSize, peaks, nil)
+	if !ok || len(rest) != 0 || !bytes.Equal(root, oldRoot) {
+		return false
+	}
+
+	root, rest, ok = walkConsistency(h, oldSize, newSize, peaks, hashes)
+	if !ok || len(rest) != 0 {
+		return false
+	}
+	return bytes.Equal(root, newRoot)
+}
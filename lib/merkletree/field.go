@@ -0,0 +1,102 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+)
+
+// Element is satisfied by the pointer to the fr.Element type of every curve
+// of gnark-crypto.
+type Element[E any] interface {
+	*E
+	Marshal() []byte
+	SetBytes([]byte) *E
+}
+
+// FieldProof is a proof over field elements. Path holds the leaf followed by
+// its siblings and can be assigned as is to merklecircuit.Circuit.Path.
+type FieldProof[E any] struct {
+	Root      E
+	Path      []E
+	Index     uint64
+	NumLeaves uint64
+}
+
+// fieldSegments returns the leaves as consecutive segments of equal size.
+func fieldSegments[E any, PE Element[E]](leaves []E) ([]byte, int) {
+	if len(leaves) == 0 {
+		return nil, 1
+	}
+	size := len(PE(&leaves[0]).Marshal())
+	data := make([]byte, 0, len(leaves)*size)
+	for i := range leaves {
+		data = append(data, PE(&leaves[i]).Marshal()...)
+	}
+	return data, size
+}
+
+func fieldElement[E any, PE Element[E]](b []byte) E {
+	var e E
+	PE(&e).SetBytes(b)
+	return e
+}
+
+// FieldRoot returns the root of the tree of leaves. h must be the MiMC of the
+// field of the leaves.
+func FieldRoot[E any, PE Element[E]](h hash.Hash, leaves []E) (E, error) {
+	if len(leaves) == 0 {
+		var e E
+		return e, errors.New("empty tree")
+	}
+	data, size := fieldSegments[E, PE](leaves)
+	root, err := ReaderRoot(bytes.NewReader(data), h, size)
+	if err != nil {
+		var e E
+		return e, err
+	}
+	return fieldElement[E, PE](root), nil
+}
+
+// BuildFieldMultiProof returns the proofs of all indices, reading the leaves
+// once.
+func BuildFieldMultiProof[E any, PE Element[E]](h hash.Hash, leaves []E, indices []uint64) ([]FieldProof[E], error) {
+	data, size := fieldSegments[E, PE](leaves)
+	root, proofSets, mp, err := BuildReaderMultiProof(bytes.NewReader(data), h, size, indices)
+	if err != nil {
+		return nil, err
+	}
+
+	proofs := make([]FieldProof[E], len(indices))
+	for k, proofSet := range proofSets {
+		proofs[k] = FieldProof[E]{
+			Root:      fieldElement[E, PE](root),
+			Path:      make([]E, len(proofSet)),
+			Index:     indices[k],
+			NumLeaves: mp.NumLeaves,
+		}
+		for i := range proofSet {
+			proofs[k].Path[i] = fieldElement[E, PE](proofSet[i])
+		}
+	}
+	return proofs, nil
+}
+
+// BuildFieldProof returns the proof of the leaf at index.
+func BuildFieldProof[E any, PE Element[E]](h hash.Hash, leaves []E, index uint64) (FieldProof[E], error) {
+	proofs, err := BuildFieldMultiProof[E, PE](h, leaves, []uint64{index})
+	if err != nil {
+		return FieldProof[E]{}, err
+	}
+	return proofs[0], nil
+}
+
+// VerifyFieldProof returns true if the first element of the path is the leaf
+// at p.Index of the tree of p.NumLeaves leaves with root p.Root.
+func VerifyFieldProof[E any, PE Element[E]](h hash.Hash, p FieldProof[E]) bool {
+	proofSet := make([][]byte, len(p.Path))
+	for i := range p.Path {
+		proofSet[i] = PE(&p.Path[i]).Marshal()
+	}
+	return VerifySizedProof(h, PE(&p.Root).Marshal(), proofSet, p.Index, p.NumLeaves)
+}
@@ -17,12 +17,12 @@ func (t *ProofTree) Legacy_Prove() (merkleRoot []byte, proofSet [][]byte, proofI
 
 	// Return nil if the ProofTree is empty, or if the proofIndex hasn't yet been
 	// reached.
-	if t.head == nil || len(t.proofSet) == 0 {
-		return t.Root(), nil, t.proofIndex, t.currentIndex
+	if t.head == nil || len(t.proofSets[0]) == 0 {
+		return t.Legacy_Root(), nil, t.proofIndices[0], t.currentIndex
 	}
 
-	//fmt.Println("prooflen: ", len(t.proofSet))
-	proofSet = t.proofSet
+	//fmt.Println("prooflen: ", len(t.proofSets[0]))
+	proofSet = append([][]byte(nil), t.proofSets[0]...)
 
 	// The set of subtrees must now be collapsed into a single root. The proof
 	// set already contains all of the elements that are members of a complete
@@ -65,7 +65,7 @@ func (t *ProofTree) Legacy_Prove() (merkleRoot []byte, proofSet [][]byte, proofI
 		proofSet = append(proofSet, current.sum)
 		current = current.next
 	}
-	return t.Root(), proofSet, t.proofIndex, t.currentIndex
+	return t.Legacy_Root(), proofSet, t.proofIndices[0], t.currentIndex
 }
 
 func (t *ProofTree) Legacy_Root() []byte {
@@ -0,0 +1,257 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	mbits "math/bits"
+)
+
+// MMR is a Merkle Mountain Range: an append-only list of perfect binary
+// trees, one per set bit of the number of leaves, like the heightRoot
+// entries of RTree. Nodes never change once appended, so a leaf keeps its
+// position and a proof made at some size can be extended to any later size.
+// The root bags the peaks from right to left.
+//
+// Nodes are kept in post-order: a leaf is followed by the parents it
+// completes. The node of height k covering the leaves [q<<k, (q+1)<<k) is
+// at position MMRPosition((q+1)<<k-1)+k.
+type MMR struct {
+	hash      hash.Hash
+	nodes     [][]byte
+	numLeaves uint64
+}
+
+// MMRProof proves the leaf at Index among the first NumLeaves leaves of an
+// MMR. Path holds the siblings from the leaf up to the peak of its mountain
+// and Peaks all peaks, from the highest mountain to the lowest.
+type MMRProof struct {
+	Index     uint64
+	NumLeaves uint64
+	Leaf      []byte
+	Path      [][]byte
+	Peaks     [][]byte
+}
+
+// MMRExtension extends an MMRProof made for fewer leaves to the first
+// NumLeaves leaves. Path holds the siblings from the old peak of the mountain
+// of the leaf up to its new peak, and Peaks all peaks of the larger range.
+// Nodes never change, so the path of the proof is kept as is.
+type MMRExtension struct {
+	NumLeaves uint64
+	Path      [][]byte
+	Peaks     [][]byte
+}
+
+func NewMMR(h hash.Hash) *MMR {
+	return &MMR{hash: h}
+}
+
+// MMRPosition returns the position of the i-th leaf among the nodes.
+func MMRPosition(i uint64) uint64 {
+	return 2*i - uint64(mbits.OnesCount64(i))
+}
+
+// mmrNode returns the position of the node at height k and index q of its
+// level.
+func mmrNode(k int, q uint64) uint64 {
+	return MMRPosition((q+1)<<uint(k)-1) + uint64(k)
+}
+
+// mmrPeaks returns the height and level index of every peak of an MMR of
+// numLeaves leaves, from left to right.
+func mmrPeaks(numLeaves uint64) (heights []int, indices []uint64) {
+	var start uint64
+	for k := 63; k >= 0; k-- {
+		if numLeaves&(1<<uint(k)) != 0 {
+			heights = append(heights, k)
+			indices = append(indices, start>>uint(k))
+			start += 1 << uint(k)
+		}
+	}
+	return heights, indices
+}
+
+// Append adds a leaf and returns its index.
+func (m *MMR) Append(data []byte) uint64 {
+	i := m.numLeaves
+	m.nodes = append(m.nodes, leafSum(m.hash, data))
+	for k := 0; k < mbits.TrailingZeros64(^i); k++ {
+		right := m.nodes[len(m.nodes)-1]
+		left := m.nodes[len(m.nodes)-1-(2<<uint(k)-1)]
+		m.nodes = append(m.nodes, nodeSum(m.hash, left, right))
+	}
+	m.numLeaves++
+	return i
+}
+
+// NumLeaves returns the number of leaves appended.
+func (m *MMR) NumLeaves() uint64 {
+	return m.numLeaves
+}
+
+// Peaks returns the peaks of the MMR when it had numLeaves leaves.
+func (m *MMR) Peaks(numLeaves uint64) ([][]byte, error) {
+	if numLeaves > m.numLeaves {
+		return nil, errors.New("more leaves than appended")
+	}
+	heights, indices := mmrPeaks(numLeaves)
+	peaks := make([][]byte, len(heights))
+	for j := range peaks {
+		peaks[j] = append([]byte(nil), m.nodes[mmrNode(heights[j], indices[j])]...)
+	}
+	return peaks, nil
+}
+
+// BagPeaks returns the root of an MMR given its peaks, or nil if there are
+// none.
+func BagPeaks(h hash.Hash, peaks [][]byte) []byte {
+	if len(peaks) == 0 {
+		return nil
+	}
+	root := peaks[len(peaks)-1]
+	for j := len(peaks) - 2; j >= 0; j-- {
+		root = nodeSum(h, peaks[j], root)
+	}
+	return root
+}
+
+// Root returns the root of the MMR, or nil if it is empty.
+func (m *MMR) Root() []byte {
+	peaks, _ := m.Peaks(m.numLeaves)
+	return BagPeaks(m.hash, peaks)
+}
+
+// Prove returns the proof of the i-th leaf, given its data, in the MMR of
+// the first numLeaves leaves.
+func (m *MMR) Prove(i uint64, leaf []byte, numLeaves uint64) (*MMRProof, error) {
+	if numLeaves > m.numLeaves {
+		return nil, errors.New("more leaves than appended")
+	}
+	if i >= numLeaves {
+		return nil, errors.New("leaf index out of range")
+	}
+	if !bytes.Equal(leafSum(m.hash, leaf), m.nodes[MMRPosition(i)]) {
+		return nil, errors.New("leaf data doesn't match")
+	}
+
+	peaks, _ := m.Peaks(numLeaves)
+	p := &MMRProof{
+		Index:     i,
+		NumLeaves: numLeaves,
+		Leaf:      append([]byte(nil), leaf...),
+		Peaks:     peaks,
+	}
+	for k := 0; k < mmrHeight(i, numLeaves); k++ {
+		p.Path = append(p.Path, append([]byte(nil), m.nodes[mmrNode(k, (i>>uint(k))^1)]...))
+	}
+	return p, nil
+}
+
+// ProveExtension returns the extension of p to the first numLeaves leaves.
+// Only the siblings above the old peak of the leaf are read, p isn't checked
+// against the MMR.
+func (m *MMR) ProveExtension(p *MMRProof, numLeaves uint64) (*MMRExtension, error) {
+	if numLeaves > m.numLeaves {
+		return nil, errors.New("more leaves than appended")
+	}
+	if p.Index >= p.NumLeaves || p.NumLeaves > numLeaves {
+		return nil, errors.New("proof doesn't precede the range")
+	}
+
+	peaks, _ := m.Peaks(numLeaves)
+	e := &MMRExtension{
+		NumLeaves: numLeaves,
+		Peaks:     peaks,
+	}
+	for k := mmrHeight(p.Index, p.NumLeaves); k < mmrHeight(p.Index, numLeaves); k++ {
+		e.Path = append(e.Path, append([]byte(nil), m.nodes[mmrNode(k, (p.Index>>uint(k))^1)]...))
+	}
+	return e, nil
+}
+
+// ExtendMMRProof returns p extended by e, which VerifyMMRProof checks against
+// the root of the larger range. Neither p nor e are verified.
+func ExtendMMRProof(p *MMRProof, e *MMRExtension) (*MMRProof, error) {
+	if p == nil || e == nil || p.Index >= p.NumLeaves || p.NumLeaves > e.NumLeaves {
+		return nil, errors.New("proof doesn't precede the extension")
+	}
+	if len(p.Path)+len(e.Path) != mmrHeight(p.Index, e.NumLeaves) {
+		return nil, errors.New("extension doesn't match the proof")
+	}
+
+	np := &MMRProof{
+		Index:     p.Index,
+		NumLeaves: e.NumLeaves,
+		Leaf:      append([]byte(nil), p.Leaf...),
+		Peaks:     make([][]byte, len(e.Peaks)),
+	}
+	for _, sibling := range append(append([][]byte(nil), p.Path...), e.Path...) {
+		np.Path = append(np.Path, append([]byte(nil), sibling...))
+	}
+	for j := range e.Peaks {
+		np.Peaks[j] = append([]byte(nil), e.Peaks[j]...)
+	}
+	return np, nil
+}
+
+// VerifyMMRExtension returns true if p extended by e proves p.Leaf in the
+// MMR of e.NumLeaves leaves with the given root. Only the proof and the
+// extension are needed, not the MMR.
+func VerifyMMRExtension(h hash.Hash, root []byte, p *MMRProof, e *MMRExtension) bool {
+	np, err := ExtendMMRProof(p, e)
+	return err == nil && VerifyMMRProof(h, root, np)
+}
+
+// ExtendProof returns p made for the current number of leaves. The path of p
+// must match the MMR, so that a proof held since an earlier epoch is only
+// extended by the log it was issued from.
+func (m *MMR) ExtendProof(p *MMRProof) (*MMRProof, error) {
+	e, err := m.ProveExtension(p, m.numLeaves)
+	if err != nil {
+		return nil, err
+	}
+	np, err := ExtendMMRProof(p, e)
+	if err != nil {
+		return nil, err
+	}
+	if !VerifyMMRProof(m.hash, BagPeaks(m.hash, e.Peaks), np) {
+		return nil, errors.New("proof doesn't match the range")
+	}
+	return np, nil
+}
+
+// mmrHeight returns the height of the mountain of the i-th leaf, which is
+// the highest bit where i and numLeaves differ.
+func mmrHeight(i, numLeaves uint64) int {
+	return mbits.Len64(i^numLeaves) - 1
+}
+
+// VerifyMMRProof returns true if p.Leaf is the p.Index-th leaf of the MMR of
+// p.NumLeaves leaves with the given root.
+func VerifyMMRProof(h hash.Hash, root []byte, p *MMRProof) bool {
+	if p == nil || p.Index >= p.NumLeaves {
+		return false
+	}
+	height := mmrHeight(p.Index, p.NumLeaves)
+	heights, _ := mmrPeaks(p.NumLeaves)
+	if len(p.Path) != height || len(p.Peaks) != len(heights) {
+		return false
+	}
+
+	sum := leafSum(h, p.Leaf)
+	for k, sibling := range p.Path {
+		if (p.Index>>uint(k))%2 == 0 {
+			sum = nodeSum(h, sum, sibling)
+		} else {
+			sum = nodeSum(h, sibling, sum)
+		}
+	}
+
+	// the mountain of the leaf follows one mountain per higher set bit
+	peak := mbits.OnesCount64(p.NumLeaves >> uint(height+1))
+	if !bytes.Equal(sum, p.Peaks[peak]) {
+		return false
+	}
+	return bytes.Equal(BagPeaks(h, p.Peaks), root)
+}
@@ -0,0 +1,183 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+	"sort"
+)
+
+// MultiProof proves several leaves of the same tree at once. Sibling nodes
+// shared by the paths, or computable from the proven leaves themselves, are
+// stored only once.
+type MultiProof struct {
+	Indices   []uint64 // strictly increasing leaf indices
+	Leaves    [][]byte // leaf data, in the order of Indices
+	Hashes    [][]byte // missing siblings, level by level from left to right
+	NumLeaves uint64
+}
+
+// NewMultiProof compresses the proof sets returned by ProveMulti into a
+// MultiProof. Duplicated indices are proven only once.
+func NewMultiProof(proofSets [][][]byte, proofIndices []uint64, numLeaves uint64) (*MultiProof, error) {
+	if len(proofSets) == 0 || len(proofSets) != len(proofIndices) {
+		return nil, errors.New("proof sets don't match proof indices")
+	}
+
+	depth := TreeDepth(numLeaves, 2)
+	order := make([]int, len(proofIndices))
+	for k := range order {
+		if proofIndices[k] >= numLeaves {
+			return nil, errors.New("proof index out of range")
+		}
+		if len(proofSets[k]) != depth+1 {
+			return nil, errors.New("invalid proof set length")
+		}
+		order[k] = k
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return proofIndices[order[i]] < proofIndices[order[j]]
+	})
+
+	mp := &MultiProof{
+		NumLeaves: numLeaves,
+	}
+
+	// positions of the known nodes at the current height, and for each of
+	// them a proof set whose leaf is below it.
+	var pos []uint64
+	var owner []int
+	for _, k := range order {
+		if len(pos) != 0 && pos[len(pos)-1] == proofIndices[k] {
+			continue
+		}
+		mp.Indices = append(mp.Indices, proofIndices[k])
+		mp.Leaves = append(mp.Leaves, proofSets[k][0])
+		pos = append(pos, proofIndices[k])
+		owner = append(owner, k)
+	}
+
+	for height := 0; height < depth; height++ {
+		width := LevelWidth(numLeaves, 2, height)
+		var npos []uint64
+		var nowner []int
+		for i := 0; i < len(pos); i++ {
+			p := pos[i]
+			if p%2 == 0 && i+1 < len(pos) && pos[i+1] == p+1 {
+				i++
+			} else if p^1 < width {
+				mp.Hashes = append(mp.Hashes, proofSets[owner[i]][height+1])
+			}
+			npos = append(npos, p/2)
+			nowner = append(nowner, owner[i])
+		}
+		pos, owner = npos, nowner
+	}
+
+	return mp, nil
+}
+
+// VerifyMultiProof returns true if all leaves of mp are members of the tree
+// with the given root and leaf count.
+func VerifyMultiProof(h hash.Hash, merkleRoot []byte, mp *MultiProof) bool {
+	if merkleRoot == nil {
+		return false
+	}
+	nodes, ok := mp.Nodes(h)
+	if !ok {
+		return false
+	}
+	return bytes.Equal(nodes[len(nodes)-1][0], merkleRoot)
+}
+
+// Nodes walks mp up to the root and returns the nodes it reveals at every
+// height, from the leaf sums up, by position: the ancestors of the proven
+// leaves and the siblings taken from Hashes. ok is false if mp is malformed
+// or Hashes don't match its indices.
+func (mp *MultiProof) Nodes(h hash.Hash) (nodes []map[uint64][]byte, ok bool) {
+	if mp == nil || len(mp.Indices) == 0 || len(mp.Indices) != len(mp.Leaves) {
+		return nil, false
+	}
+	for i := range mp.Indices {
+		if i > 0 && mp.Indices[i] <= mp.Indices[i-1] {
+			return nil, false
+		}
+	}
+	if mp.Indices[len(mp.Indices)-1] >= mp.NumLeaves {
+		return nil, false
+	}
+
+	depth := TreeDepth(mp.NumLeaves, 2)
+	nodes = make([]map[uint64][]byte, depth+1)
+	nodes[0] = make(map[uint64][]byte)
+	pos := append([]uint64(nil), mp.Indices...)
+	sums := make([][]byte, len(mp.Leaves))
+	for i, leaf := range mp.Leaves {
+		sums[i] = leafSum(h, leaf)
+		nodes[0][pos[i]] = sums[i]
+	}
+
+	hashes := mp.Hashes
+	for height := 0; height < depth; height++ {
+		width := LevelWidth(mp.NumLeaves, 2, height)
+		nodes[height+1] = make(map[uint64][]byte)
+		var npos []uint64
+		var nsums [][]byte
+		for i := 0; i < len(pos); i++ {
+			p := pos[i]
+			var sum []byte
+			if p%2 == 0 && i+1 < len(pos) && pos[i+1] == p+1 {
+				sum = nodeSum(h, sums[i], sums[i+1])
+				i++
+			} else {
+				sibling := sums[i]
+				if p^1 < width {
+					if len(hashes) == 0 {
+						return nil, false
+					}
+					sibling = hashes[0]
+					hashes = hashes[1:]
+					nodes[height][p^1] = sibling
+				}
+				if p%2 == 0 {
+					sum = nodeSum(h, sums[i], sibling)
+				} else {
+					sum = nodeSum(h, sibling, sums[i])
+				}
+			}
+			npos = append(npos, p/2)
+			nsums = append(nsums, sum)
+			nodes[height+1][p/2] = sum
+		}
+		pos, sums = npos, nsums
+	}
+
+	if len(hashes) != 0 || len(sums) != 1 {
+		return nil, false
+	}
+	return nodes, true
+}
+
+// BuildReaderMultiProof reads the data once and returns the proof sets of all
+// indices, in the given order, together with their compressed MultiProof.
+func BuildReaderMultiProof(r io.Reader, h hash.Hash, segmentSize int, indices []uint64) (root []byte, proofSets [][][]byte, multiProof *MultiProof, err error) {
+	tree := New(h)
+	err = tree.SetIndices(indices)
+	if err != nil {
+		return
+	}
+	err = tree.ReadAll(r, segmentSize)
+	if err != nil {
+		return
+	}
+	root, proofSets, _, numLeaves := tree.ProveMulti()
+	for _, proofSet := range proofSets {
+		if len(proofSet) == 0 {
+			err = errors.New("index was not reached while creating proof")
+			return
+		}
+	}
+	multiProof, err = NewMultiProof(proofSets, indices, numLeaves)
+	return
+}
@@ -0,0 +1,317 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	gchash "github.com/consensys/gnark-crypto/hash"
+	p2bls377 "github.com/yydfjt/gnark-example/lib/poseidon2/bls12377"
+	p2bn254 "github.com/yydfjt/gnark-example/lib/poseidon2/bn254"
+	"golang.org/x/crypto/sha3"
+)
+
+// ProofVersion is the current version of the MerkleProof encodings.
+const ProofVersion = 1
+
+var proofMagic = [4]byte{'M', 'K', 'P', 'F'}
+
+// HashID identifies the hash function a proof was built with.
+type HashID uint8
+
+const (
+	HashSHA256 HashID = iota + 1
+	HashMiMCBN254
+	HashMiMCBLS12377
+	HashMiMCBLS12381
+	HashMiMCBW6761
+	HashPoseidon2BN254
+	HashPoseidon2BLS12377
+	HashKeccak256
+)
+
+// hashInfo describes a HashID. The MiMC hashes are those of gnark-crypto,
+// identified by mimc, and new is only set for the others.
+type hashInfo struct {
+	name  string
+	curve ecc.ID // the curve of the circuits computing it, if any
+	mimc  gchash.Hash
+	new   func() hash.Hash
+}
+
+var hashes = map[HashID]hashInfo{
+	HashSHA256:            {name: "SHA256", curve: ecc.UNKNOWN, new: sha256.New},
+	HashMiMCBN254:         {name: "MIMC_BN254", curve: ecc.BN254, mimc: gchash.MIMC_BN254},
+	HashMiMCBLS12377:      {name: "MIMC_BLS12_377", curve: ecc.BLS12_377, mimc: gchash.MIMC_BLS12_377},
+	HashMiMCBLS12381:      {name: "MIMC_BLS12_381", curve: ecc.BLS12_381, mimc: gchash.MIMC_BLS12_381},
+	HashMiMCBW6761:        {name: "MIMC_BW6_761", curve: ecc.BW6_761, mimc: gchash.MIMC_BW6_761},
+	HashPoseidon2BN254:    {name: "POSEIDON2_BN254", curve: ecc.BN254, new: p2bn254.NewPoseidon2},
+	HashPoseidon2BLS12377: {name: "POSEIDON2_BLS12_377", curve: ecc.BLS12_377, new: p2bls377.NewPoseidon2},
+	HashKeccak256:         {name: "KECCAK256", curve: ecc.UNKNOWN, new: sha3.NewLegacyKeccak256},
+}
+
+func (id HashID) String() string {
+	if info, ok := hashes[id]; ok {
+		return info.name
+	}
+	return fmt.Sprintf("HashID(%d)", uint8(id))
+}
+
+// ParseHashID returns the hash of the given name, as printed by String.
+func ParseHashID(name string) (HashID, error) {
+	for id, info := range hashes {
+		if info.name == name {
+			return id, nil
+		}
+	}
+	return 0, errors.New("unknown hash")
+}
+
+// MiMC returns the gnark-crypto ID of a MiMC hash.
+func (id HashID) MiMC() (gchash.Hash, bool) {
+	info, ok := hashes[id]
+	return info.mimc, ok && info.new == nil
+}
+
+// Curve returns the curve over whose scalar field the hash is defined, i.e.
+// the curve of the circuits that can compute it natively.
+func (id HashID) Curve() (ecc.ID, error) {
+	if info, ok := hashes[id]; ok && info.curve != ecc.UNKNOWN {
+		return info.curve, nil
+	}
+	return ecc.UNKNOWN, errors.New("hash is not defined over a field")
+}
+
+// New returns a new hash of the given ID.
+func (id HashID) New() (hash.Hash, error) {
+	info, ok := hashes[id]
+	if !ok {
+		return nil, errors.New("unknown hash id")
+	}
+	if info.new == nil {
+		return info.mimc.New(), nil
+	}
+	return info.new(), nil
+}
+
+// MerkleProof is a self-describing proof that can be stored and exchanged.
+// Path is the proof set returned by Prove: the leaf data followed by the
+// siblings of every level.
+type MerkleProof struct {
+	Version     uint8
+	Hash        HashID
+	Domain      Domain
+	Arity       int
+	SegmentSize int
+	Index       uint64
+	NumLeaves   uint64
+	Path        [][]byte
+}
+
+// NewMerkleProof wraps a binary proof set in a MerkleProof.
+func NewMerkleProof(id HashID, segmentSize int, index uint64, numLeaves uint64, proofSet [][]byte) *MerkleProof {
+	return &MerkleProof{
+		Version:     ProofVersion,
+		Hash:        id,
+		Domain:      DomainNone,
+		Arity:       2,
+		SegmentSize: segmentSize,
+		Index:       index,
+		NumLeaves:   numLeaves,
+		Path:        proofSet,
+	}
+}
+
+// Check returns an error if the proof is not well formed.
+func (p *MerkleProof) Check() error {
+	if p.Version != ProofVersion {
+		return errors.New("unsupported proof version")
+	}
+	h, err := p.Hash.New()
+	if err != nil {
+		return err
+	}
+	if p.Domain > DomainTagged {
+		return errors.New("unknown domain")
+	}
+	if p.Arity < 2 || p.Arity > 255 {
+		return errors.New("invalid arity")
+	}
+	if p.SegmentSize <= 0 {
+		return errors.New("invalid segment size")
+	}
+	if p.Index >= p.NumLeaves {
+		return errors.New("leaf index out of range")
+	}
+	if len(p.Path) != 1+TreeDepth(p.NumLeaves, p.Arity)*(p.Arity-1) {
+		return errors.New("proof length doesn't match leaf count")
+	}
+	if len(p.Path[0]) == 0 || len(p.Path[0]) > p.SegmentSize {
+		return errors.New("invalid leaf size")
+	}
+	for _, node := range p.Path[1:] {
+		if len(node) != h.Size() {
+			return errors.New("invalid node size")
+		}
+	}
+	return nil
+}
+
+// Verify returns true if the proof is well formed and leads to root.
+func (p *MerkleProof) Verify(root []byte) bool {
+	if p.Check() != nil {
+		return false
+	}
+	h, _ := p.Hash.New()
+	return VerifySizedProofArity(WithDomain(h, p.Domain), p.Arity, root, p.Path, p.Index, p.NumLeaves)
+}
+
+// MarshalBinary encodes the proof as
+//
+//	magic "MKPF" | version u8 | hash u8 | domain u8 | arity u8 |
+//	segment size u32 | index u64 | leaves u64 | path length u32 |
+//	path entries as length u32 followed by the bytes
+//
+// all integers big endian.
+func (p *MerkleProof) MarshalBinary() ([]byte, error) {
+	if err := p.Check(); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, 32+len(p.Path)*(4+len(p.Path[0])))
+	buf = append(buf, proofMagic[:]...)
+	buf = append(buf, p.Version, uint8(p.Hash), uint8(p.Domain), uint8(p.Arity))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(p.SegmentSize))
+	buf = binary.BigEndian.AppendUint64(buf, p.Index)
+	buf = binary.BigEndian.AppendUint64(buf, p.NumLeaves)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(p.Path)))
+	for _, node := range p.Path {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(node)))
+		buf = append(buf, node...)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a proof encoded with MarshalBinary and rejects
+// malformed proofs.
+func (p *MerkleProof) UnmarshalBinary(data []byte) error {
+	d := decoder{data: data}
+	if !bytes.Equal(d.bytes(4)[:4], proofMagic[:]) {
+		return errors.New("invalid proof encoding")
+	}
+	head := d.bytes(4)
+	var np MerkleProof
+	np.Version = head[0]
+	np.Hash = HashID(head[1])
+	np.Domain = Domain(head[2])
+	np.Arity = int(head[3])
+	np.SegmentSize = int(d.uint32())
+	np.Index = d.uint64()
+	np.NumLeaves = d.uint64()
+
+	n := int(d.uint32())
+	if d.err == nil && n > len(d.data)/4 {
+		return errors.New("invalid proof length")
+	}
+	for i := 0; i < n && d.err == nil; i++ {
+		np.Path = append(np.Path, d.bytes(int(d.uint32())))
+	}
+
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.data) != 0 {
+		return errors.New("trailing data after proof")
+	}
+	if err := np.Check(); err != nil {
+		return err
+	}
+
+	*p = np
+	return nil
+}
+
+type jsonProof struct {
+	Version     uint8    `json:"version"`
+	Hash        string   `json:"hash"`
+	Domain      string   `json:"domain"`
+	Arity       int      `json:"arity"`
+	SegmentSize int      `json:"segmentSize"`
+	Index       uint64   `json:"index"`
+	NumLeaves   uint64   `json:"numLeaves"`
+	Path        []string `json:"path"`
+}
+
+// MarshalJSON encodes the proof with names for the hash and domain and hex
+// strings for the path.
+func (p *MerkleProof) MarshalJSON() ([]byte, error) {
+	if err := p.Check(); err != nil {
+		return nil, err
+	}
+
+	jp := jsonProof{
+		Version:     p.Version,
+		Hash:        p.Hash.String(),
+		Domain:      p.Domain.String(),
+		Arity:       p.Arity,
+		SegmentSize: p.SegmentSize,
+		Index:       p.Index,
+		NumLeaves:   p.NumLeaves,
+		Path:        make([]string, len(p.Path)),
+	}
+	for i, node := range p.Path {
+		jp.Path[i] = hex.EncodeToString(node)
+	}
+	return json.Marshal(&jp)
+}
+
+// UnmarshalJSON decodes a proof encoded with MarshalJSON and rejects
+// malformed proofs.
+func (p *MerkleProof) UnmarshalJSON(data []byte) error {
+	var jp jsonProof
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&jp); err != nil {
+		return err
+	}
+
+	np := MerkleProof{
+		Version:     jp.Version,
+		Arity:       jp.Arity,
+		SegmentSize: jp.SegmentSize,
+		Index:       jp.Index,
+		NumLeaves:   jp.NumLeaves,
+	}
+
+	id, err := ParseHashID(jp.Hash)
+	if err != nil {
+		return err
+	}
+	np.Hash = id
+	d, err := ParseDomain(jp.Domain)
+	if err != nil {
+		return err
+	}
+	np.Domain = d
+
+	for _, s := range jp.Path {
+		node, err := hex.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		np.Path = append(np.Path, node)
+	}
+
+	if err := np.Check(); err != nil {
+		return err
+	}
+
+	*p = np
+	return nil
+}
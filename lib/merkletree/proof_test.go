@@ -0,0 +1,137 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestMerkleProofEncoding(t *testing.T) {
+	h, _ := HashMiMCBN254.New()
+	fieldSize := h.Size()
+
+	var buf bytes.Buffer
+	numLeaves := 1<<4 + 5
+	for i := 0; i < numLeaves; i++ {
+		b := GenRandom(fieldSize)
+		b[0] = 0
+		buf.Write(b)
+	}
+
+	index := uint64(numLeaves - 2)
+	root, proofSet, n, err := BuildReaderProof(&buf, h, fieldSize, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMerkleProof(HashMiMCBN254, fieldSize, index, n, proofSet)
+	if !p.Verify(root) {
+		t.Fatal("wrong merkle proof")
+	}
+
+	bin, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bp MerkleProof
+	if err := bp.UnmarshalBinary(bin); err != nil {
+		t.Fatal(err)
+	}
+	if !bp.Verify(root) {
+		t.Fatal("wrong decoded binary proof")
+	}
+
+	js, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jp MerkleProof
+	if err := json.Unmarshal(js, &jp); err != nil {
+		t.Fatal(err)
+	}
+	if !jp.Verify(root) {
+		t.Fatal("wrong decoded json proof")
+	}
+
+	// every truncation and a trailing byte must be rejected
+	for i := 0; i < len(bin); i++ {
+		if err := new(MerkleProof).UnmarshalBinary(bin[:i]); err == nil {
+			t.Fatal("decoded a truncated proof at: ", i)
+		}
+	}
+	if err := new(MerkleProof).UnmarshalBinary(append(bin, 0)); err == nil {
+		t.Fatal("decoded a proof with trailing data")
+	}
+
+	malformed := []func(p *MerkleProof){
+		func(p *MerkleProof) { p.Version = 2 },
+		func(p *MerkleProof) { p.Hash = 0 },
+		func(p *MerkleProof) { p.Domain = 7 },
+		func(p *MerkleProof) { p.Arity = 1 },
+		func(p *MerkleProof) { p.Index = p.NumLeaves },
+		func(p *MerkleProof) { p.NumLeaves = 1 << 10 },
+		func(p *MerkleProof) { p.Path = p.Path[:len(p.Path)-1] },
+		func(p *MerkleProof) { p.Path[1] = p.Path[1][1:] },
+		func(p *MerkleProof) { p.Path[0] = append(p.Path[0], 0) },
+	}
+	for i, f := range malformed {
+		var mp MerkleProof
+		mp.UnmarshalBinary(bin)
+		f(&mp)
+
+		if mp.Verify(root) {
+			t.Fatal("verified malformed proof: ", i)
+		}
+
+		// encode by hand, the encoders refuse malformed proofs
+		jp := jsonProof{
+			Version:     mp.Version,
+			Hash:        mp.Hash.String(),
+			Domain:      mp.Domain.String(),
+			Arity:       mp.Arity,
+			SegmentSize: mp.SegmentSize,
+			Index:       mp.Index,
+			NumLeaves:   mp.NumLeaves,
+		}
+		for _, node := range mp.Path {
+			jp.Path = append(jp.Path, string(bytes.Repeat([]byte("0"), 2*len(node))))
+		}
+		js, _ := json.Marshal(&jp)
+		if err := new(MerkleProof).UnmarshalJSON(js); err == nil {
+			t.Fatal("decoded malformed json proof: ", i)
+		}
+		if _, err := mp.MarshalBinary(); err == nil {
+			t.Fatal("encoded malformed proof: ", i)
+		}
+	}
+}
+
+func TestHashID(t *testing.T) {
+	for id := range hashes {
+		if parsed, err := ParseHashID(id.String()); err != nil || parsed != id {
+			t.Fatal("name doesn't round trip: ", id)
+		}
+		h, err := id.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, ok := id.MiMC()
+		if _, err := id.Curve(); ok && err != nil {
+			t.Fatal("MiMC without a curve: ", id)
+		}
+		if ok {
+			// the digests of a one-element input agree
+			block := make([]byte, h.Size())
+			block[len(block)-1] = 1
+			gc := m.New()
+			h.Write(block)
+			gc.Write(block)
+			if !bytes.Equal(h.Sum(nil), gc.Sum(nil)) {
+				t.Fatal("wrong gnark-crypto hash: ", id)
+			}
+		}
+	}
+	if _, ok := HashSHA256.MiMC(); ok {
+		t.Fatal("SHA256 mapped to MiMC")
+	}
+}
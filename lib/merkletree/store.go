@@ -0,0 +1,434 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+const (
+	storeVersion    = 1
+	storeHeaderSize = 40
+)
+
+var storeMagic = [4]byte{'M', 'K', 'S', 'T'}
+
+// Store keeps the leaves and every level of a Merkle tree, so that a proof
+// can be produced for any index after the tree has been built. Its roots and
+// proofs are the same as those of ProofTree.
+//
+// The tree is encoded as a single buffer: a header, the leaves padded to
+// segmentSize and then all levels from the leaf sums up to the root. The
+// buffer is either kept in memory or memory-mapped from a file.
+//
+// Nodes have arity children, 2 unless built with BuildStoreArity. The hash
+// and the domain are recorded in the header, and a store is only loaded
+// with the same ones.
+type Store struct {
+	hash      hash.Hash
+	hashID    HashID
+	domain    Domain
+	hashSize  int
+	segSize   int
+	lastSize  int
+	numLeaves uint64
+	arity     int
+	header    int
+
+	data    []byte
+	offsets []int // offset of each level in data
+	unmap   func() error
+}
+
+// BuildStore reads all segments of r and keeps the whole tree in memory. The
+// tree is hashed with the hash id, separating leaves and nodes with d as in
+// WithDomain.
+func BuildStore(r io.Reader, id HashID, d Domain, segmentSize int) (*Store, error) {
+	return BuildStoreArity(r, id, d, segmentSize, 2)
+}
+
+// BuildStoreArity is BuildStore for a tree whose nodes have arity children.
+func BuildStoreArity(r io.Reader, id HashID, d Domain, segmentSize int, arity int) (*Store, error) {
+	return buildStore(r, id, d, segmentSize, arity, 1)
+}
+
+// BuildStoreParallel is BuildStoreArity hashing the leaves and each level of
+// nodes across workers goroutines, all of them if workers <= 0. The tree is
+// the same as the one built sequentially.
+func BuildStoreParallel(r io.Reader, id HashID, d Domain, segmentSize int, arity int, workers int) (*Store, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return buildStore(r, id, d, segmentSize, arity, workers)
+}
+
+// storeHash returns a constructor of the hash id separating leaves and
+// nodes with d.
+func storeHash(id HashID, d Domain) (func() hash.Hash, error) {
+	if _, err := id.New(); err != nil {
+		return nil, err
+	}
+	if d > DomainTagged {
+		return nil, errors.New("unknown domain")
+	}
+	return func() hash.Hash {
+		h, _ := id.New()
+		return WithDomain(h, d)
+	}, nil
+}
+
+func buildStore(r io.Reader, id HashID, d Domain, segmentSize int, arity int, workers int) (*Store, error) {
+	if segmentSize <= 0 {
+		return nil, errors.New("invalid segment size")
+	}
+	if arity < 2 {
+		return nil, errors.New("invalid tree arity")
+	}
+	// hash.Hash is stateful, so every goroutine gets its own
+	newHash, err := storeHash(id, d)
+	if err != nil {
+		return nil, err
+	}
+
+	h := newHash()
+	s := &Store{
+		hash:     h,
+		hashID:   id,
+		domain:   d,
+		hashSize: h.Size(),
+		segSize:  segmentSize,
+		arity:    arity,
+		header:   storeHeaderSize,
+	}
+
+	// the leaves are read in place, after the header
+	data, err := s.readLeaves(r)
+	if err != nil {
+		return nil, err
+	}
+	n := len(data) - s.header
+	s.numLeaves = uint64((n + segmentSize - 1) / segmentSize)
+	if n != 0 {
+		s.lastSize = n - int(s.numLeaves-1)*segmentSize
+	}
+
+	size := s.layout()
+	if cap(data) < size {
+		s.data = make([]byte, size)
+		copy(s.data, data)
+	} else {
+		s.data = data[:size]
+		// Read may have used the spare capacity
+		for i := len(data); i < size; i++ {
+			s.data[i] = 0
+		}
+	}
+	s.putHeader()
+
+	parallel(s.numLeaves, workers, newHash, func(h hash.Hash, i uint64) {
+		copy(s.node(0, i), leafSum(h, s.leaf(i)))
+	})
+	for height := 1; height < len(s.offsets); height++ {
+		parallel(LevelWidth(s.numLeaves, arity, height), workers, newHash, func(h hash.Hash, i uint64) {
+			copy(s.node(height, i), nodeSumN(h, s.children(height-1, i)))
+		})
+	}
+
+	return s, nil
+}
+
+// readLeaves returns a buffer holding s.header bytes followed by the data of
+// r. Its capacity leaves room for the levels of the tree, so that the leaves
+// don't have to be copied: if the length of r is known the buffer is
+// allocated once for the whole tree, otherwise it grows as it is read.
+func (s *Store) readLeaves(r io.Reader) ([]byte, error) {
+	capacity := s.header + 512
+	if n, ok := readerLen(r); ok {
+		// one more byte to see the end of r without growing
+		capacity = s.sizeFor(n) + 1
+	}
+
+	buf := make([]byte, s.header, capacity)
+	for {
+		if len(buf) == cap(buf) {
+			grown := make([]byte, len(buf), s.sizeFor(2*(len(buf)-s.header)))
+			copy(grown, buf)
+			buf = grown
+		}
+		n, err := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			return buf, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readerLen returns the number of bytes left in r, if it tells.
+func readerLen(r io.Reader) (int, bool) {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		return r.Len(), true
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		off, err := r.Seek(0, io.SeekCurrent)
+		if err != nil || off > info.Size() {
+			return 0, false
+		}
+		return int(info.Size() - off), true
+	}
+	return 0, false
+}
+
+// sizeFor returns the encoded size of the tree of n bytes of leaves.
+func (s *Store) sizeFor(n int) int {
+	t := Store{
+		hashSize:  s.hashSize,
+		segSize:   s.segSize,
+		numLeaves: uint64((n + s.segSize - 1) / s.segSize),
+		arity:     s.arity,
+		header:    s.header,
+	}
+	return t.layout()
+}
+
+// minChunk is the least number of sums given to a goroutine.
+const minChunk = 256
+
+// parallel calls f for every i in [0, n), split in contiguous chunks across
+// at most workers goroutines.
+func parallel(n uint64, workers int, newHash func() hash.Hash, f func(h hash.Hash, i uint64)) {
+	if limit := n / minChunk; uint64(workers) > limit {
+		workers = int(limit)
+	}
+	if workers <= 1 {
+		h := newHash()
+		for i := uint64(0); i < n; i++ {
+			f(h, i)
+		}
+		return
+	}
+
+	chunk := (n + uint64(workers) - 1) / uint64(workers)
+	var wg sync.WaitGroup
+	for start := uint64(0); start < n; start += chunk {
+		end := start + chunk
+		if end > n {
+			end = n
+		}
+		wg.Add(1)
+		go func(start, end uint64) {
+			defer wg.Done()
+			h := newHash()
+			for i := start; i < end; i++ {
+				f(h, i)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+}
+
+// LoadStore decodes a tree previously written with WriteTo, which must have
+// been built with the hash id and the domain d. The store keeps a reference
+// to data.
+func LoadStore(data []byte, id HashID, d Domain) (*Store, error) {
+	if len(data) < storeHeaderSize || !bytes.Equal(data[:4], storeMagic[:]) {
+		return nil, errors.New("invalid tree store")
+	}
+	if binary.BigEndian.Uint32(data[4:8]) != storeVersion {
+		return nil, errors.New("unsupported tree store version")
+	}
+	newHash, err := storeHash(id, d)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		hash:      newHash(),
+		hashSize:  int(binary.BigEndian.Uint32(data[8:12])),
+		segSize:   int(binary.BigEndian.Uint32(data[12:16])),
+		lastSize:  int(binary.BigEndian.Uint32(data[16:20])),
+		numLeaves: binary.BigEndian.Uint64(data[20:28]),
+		arity:     int(binary.BigEndian.Uint32(data[28:32])),
+		hashID:    HashID(binary.BigEndian.Uint32(data[32:36])),
+		domain:    Domain(binary.BigEndian.Uint32(data[36:40])),
+		header:    storeHeaderSize,
+	}
+	if s.hashID != id || s.hashSize != s.hash.Size() {
+		return nil, errors.New("tree store was built with another hash")
+	}
+	if s.domain != d {
+		return nil, errors.New("tree store was built with another domain")
+	}
+	if s.arity < 2 || s.segSize <= 0 || s.lastSize > s.segSize || (s.numLeaves != 0) != (s.lastSize != 0) {
+		return nil, errors.New("invalid tree store header")
+	}
+	if s.numLeaves > uint64(len(data)/s.segSize) {
+		return nil, errors.New("invalid tree store size")
+	}
+	if s.layout() != len(data) {
+		return nil, errors.New("invalid tree store size")
+	}
+	s.data = data
+
+	return s, nil
+}
+
+// OpenStore opens a tree file written with WriteTo, built with the hash id
+// and the domain d. The file is memory-mapped where the platform allows it,
+// and read into memory otherwise. Close must be called to release it.
+func OpenStore(path string, id HashID, d Domain) (*Store, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, unmap, err := mapFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := LoadStore(data, id, d)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	s.unmap = unmap
+	return s, nil
+}
+
+// layout computes the level offsets and returns the encoded size.
+func (s *Store) layout() int {
+	off := s.header + int(s.numLeaves)*s.segSize
+	s.offsets = s.offsets[:0]
+	if s.numLeaves == 0 {
+		return off
+	}
+	for height := 0; height <= TreeDepth(s.numLeaves, s.arity); height++ {
+		s.offsets = append(s.offsets, off)
+		off += int(LevelWidth(s.numLeaves, s.arity, height)) * s.hashSize
+	}
+	return off
+}
+
+func (s *Store) putHeader() {
+	copy(s.data[:4], storeMagic[:])
+	binary.BigEndian.PutUint32(s.data[4:8], storeVersion)
+	binary.BigEndian.PutUint32(s.data[8:12], uint32(s.hashSize))
+	binary.BigEndian.PutUint32(s.data[12:16], uint32(s.segSize))
+	binary.BigEndian.PutUint32(s.data[16:20], uint32(s.lastSize))
+	binary.BigEndian.PutUint64(s.data[20:28], s.numLeaves)
+	binary.BigEndian.PutUint32(s.data[28:32], uint32(s.arity))
+	binary.BigEndian.PutUint32(s.data[32:36], uint32(s.hashID))
+	binary.BigEndian.PutUint32(s.data[36:40], uint32(s.domain))
+}
+
+// node returns the i-th node at the given height.
+func (s *Store) node(height int, i uint64) []byte {
+	off := s.offsets[height] + int(i)*s.hashSize
+	return s.data[off : off+s.hashSize : off+s.hashSize]
+}
+
+// children returns the children at the given height of the i-th node one
+// level above. Missing children are filled with the last one, so the last
+// node of a binary level with odd width is its own sibling.
+func (s *Store) children(height int, i uint64) [][]byte {
+	width := LevelWidth(s.numLeaves, s.arity, height)
+	children := make([][]byte, s.arity)
+	for j := range children {
+		c := i*uint64(s.arity) + uint64(j)
+		if c >= width {
+			c = width - 1
+		}
+		children[j] = s.node(height, c)
+	}
+	return children
+}
+
+// Arity returns the number of children of a node.
+func (s *Store) Arity() int {
+	return s.arity
+}
+
+// NumLeaves returns the number of leaves in the tree.
+func (s *Store) NumLeaves() uint64 {
+	return s.numLeaves
+}
+
+// Root returns the Merkle root, or nil if the tree is empty.
+func (s *Store) Root() []byte {
+	if s.numLeaves == 0 {
+		return nil
+	}
+	return append([]byte(nil), s.node(len(s.offsets)-1, 0)...)
+}
+
+// leaf returns the i-th leaf within the store buffer.
+func (s *Store) leaf(i uint64) []byte {
+	size := s.segSize
+	if i == s.numLeaves-1 {
+		size = s.lastSize
+	}
+	off := s.header + int(i)*s.segSize
+	return s.data[off : off+size : off+size]
+}
+
+// Leaf returns the data of the i-th leaf.
+func (s *Store) Leaf(i uint64) ([]byte, error) {
+	if i >= s.numLeaves {
+		return nil, errors.New("leaf index out of range")
+	}
+	return append([]byte(nil), s.leaf(i)...), nil
+}
+
+// Prove returns the proof set of the i-th leaf, in the form returned by
+// ProofTree.Prove and accepted by VerifyProof. For other arities the proof
+// set is accepted by VerifyProofArity.
+func (s *Store) Prove(i uint64) (merkleRoot []byte, proofSet [][]byte, numLeaves uint64, err error) {
+	leaf, err := s.Leaf(i)
+	if err != nil {
+		return nil, nil, s.numLeaves, err
+	}
+
+	arity := uint64(s.arity)
+	proofSet = make([][]byte, 0, 1+(len(s.offsets)-1)*(s.arity-1))
+	proofSet = append(proofSet, leaf)
+	for height := 0; height < len(s.offsets)-1; height++ {
+		for j, c := range s.children(height, i/arity) {
+			if uint64(j) != i%arity {
+				proofSet = append(proofSet, append([]byte(nil), c...))
+			}
+		}
+		i /= arity
+	}
+
+	return s.Root(), proofSet, s.numLeaves, nil
+}
+
+// WriteTo writes the encoded tree to w.
+func (s *Store) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(s.data)
+	return int64(n), err
+}
+
+// Close releases the memory-mapped file, if any.
+func (s *Store) Close() error {
+	if s.unmap == nil {
+		return nil
+	}
+	err := s.unmap()
+	s.unmap = nil
+	s.data = nil
+	return err
+}
@@ -0,0 +1,366 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMerkelStore(t *testing.T) {
+	for nc := 1; nc < (1 << (depth + 1)); nc++ {
+		var buf bytes.Buffer
+		for i := 0; i < nc; i++ {
+			buf.Write(GenRandom(segSize))
+		}
+		buf.Write(GenRandom(nc % segSize)) // short last segment
+		data := buf.Bytes()
+
+		s, err := BuildStore(bytes.NewReader(data), HashSHA256, DomainNone, segSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		root, err := ReaderRoot(bytes.NewReader(data), sha256.New(), segSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(s.Root(), root) {
+			t.Fatal("wrong store root at: ", nc)
+		}
+
+		path := filepath.Join(t.TempDir(), "tree")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.WriteTo(f); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		ms, err := OpenStore(path, HashSHA256, DomainNone)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for j := uint64(0); j < ms.NumLeaves(); j++ {
+			proot, proofSet, _, err := BuildReaderProof(bytes.NewReader(data), sha256.New(), segSize, j)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mroot, mproofSet, numLeaves, err := ms.Prove(j)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if numLeaves != ms.NumLeaves() || !bytes.Equal(mroot, proot) || len(mproofSet) != len(proofSet) {
+				t.Fatal("store proof differs at: ", j, nc)
+			}
+			for k := range proofSet {
+				if !bytes.Equal(mproofSet[k], proofSet[k]) {
+					t.Fatal("store proof differs at: ", j, nc)
+				}
+			}
+		}
+
+		if _, _, _, err := ms.Prove(ms.NumLeaves()); err == nil {
+			t.Fatal("proved a leaf out of range")
+		}
+		if err := ms.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMerkelStoreInvalid(t *testing.T) {
+	s, err := BuildStore(bytes.NewReader(GenRandom(5*segSize)), HashSHA256, DomainNone, segSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	s.WriteTo(&buf)
+	data := buf.Bytes()
+
+	if _, err := LoadStore(data[:len(data)-1], HashSHA256, DomainNone); err == nil {
+		t.Fatal("loaded a truncated store")
+	}
+	// MiMC over BN254 has the size of SHA-256
+	if _, err := LoadStore(data, HashMiMCBN254, DomainNone); err == nil {
+		t.Fatal("loaded a store with another hash of the same size")
+	}
+	if _, err := LoadStore(data, HashSHA256, DomainNone); err != nil {
+		t.Fatal(err)
+	}
+	data[0] ^= 1
+	if _, err := LoadStore(data, HashSHA256, DomainNone); err == nil {
+		t.Fatal("loaded a store with a wrong magic")
+	}
+}
+
+func TestMerkelStoreDomain(t *testing.T) {
+	data := GenRandom(5 * segSize)
+	s, err := BuildStore(bytes.NewReader(data), HashSHA256, DomainRFC6962, segSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := ReaderRoot(bytes.NewReader(data), WithDomain(sha256.New(), DomainRFC6962), segSize)
+	if !bytes.Equal(s.Root(), root) {
+		t.Fatal("wrong store root with a domain")
+	}
+
+	var buf bytes.Buffer
+	s.WriteTo(&buf)
+	if _, err := LoadStore(buf.Bytes(), HashSHA256, DomainNone); err == nil {
+		t.Fatal("loaded a store under another domain")
+	}
+	ls, err := LoadStore(buf.Bytes(), HashSHA256, DomainRFC6962)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// updates keep hashing with the domain of the store
+	leaf := GenRandom(segSize)
+	newRoot, _, err := ls.UpdateLeaf(2, leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(data[2*segSize:], leaf)
+	root, _ = ReaderRoot(bytes.NewReader(data), WithDomain(sha256.New(), DomainRFC6962), segSize)
+	if !bytes.Equal(newRoot, root) {
+		t.Fatal("update rehashed without the domain")
+	}
+}
+
+func TestMerkelStoreArity(t *testing.T) {
+	for _, arity := range []int{2, 3, 4, 8} {
+		for nc := 1; nc < 70; nc += 3 {
+			s, err := BuildStoreArity(bytes.NewReader(GenRandom(nc*segSize)), HashSHA256, DomainNone, segSize, arity)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			s.WriteTo(&buf)
+			ls, err := LoadStore(buf.Bytes(), HashSHA256, DomainNone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ls.Arity() != arity || !bytes.Equal(ls.Root(), s.Root()) {
+				t.Fatal("wrong loaded store at: ", arity, nc)
+			}
+
+			for j := uint64(0); j < uint64(nc); j++ {
+				root, proofSet, _, err := ls.Prove(j)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(proofSet) != 1+TreeDepth(uint64(nc), arity)*(arity-1) {
+					t.Fatal("wrong proof length at: ", arity, nc)
+				}
+				if !VerifyProofArity(sha256.New(), arity, root, proofSet, j) {
+					t.Fatal("wrong proof at: ", arity, j, nc)
+				}
+				if arity == 2 && !VerifyProof(sha256.New(), root, proofSet, j) {
+					t.Fatal("wrong binary proof at: ", j, nc)
+				}
+				if nc > 1 && VerifyProofArity(sha256.New(), arity, root, proofSet, (j+1)%uint64(nc)) {
+					t.Fatal("proof accepted at another index: ", arity, j, nc)
+				}
+			}
+		}
+	}
+}
+
+func TestMerkelStoreParallel(t *testing.T) {
+	for _, arity := range []int{2, 4} {
+		for _, nc := range []int{1, 7, minChunk + 1, 5*minChunk + 3, 16 * minChunk} {
+			data := GenRandom(nc*segSize - 5)
+
+			s, err := BuildStoreArity(bytes.NewReader(data), HashSHA256, DomainNone, segSize, arity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ps, err := BuildStoreParallel(bytes.NewReader(data), HashSHA256, DomainNone, segSize, arity, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a reader of unknown length is read into a growing buffer
+			us, err := BuildStoreParallel(struct{ io.Reader }{bytes.NewReader(data)}, HashSHA256, DomainNone, segSize, arity, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf, pbuf, ubuf bytes.Buffer
+			s.WriteTo(&buf)
+			ps.WriteTo(&pbuf)
+			us.WriteTo(&ubuf)
+			if !bytes.Equal(buf.Bytes(), pbuf.Bytes()) || !bytes.Equal(buf.Bytes(), ubuf.Bytes()) {
+				t.Fatal("parallel tree differs at: ", arity, nc)
+			}
+		}
+	}
+
+	data := GenRandom(3*minChunk*segSize + 1)
+	root, err := ReaderRoot(bytes.NewReader(data), sha256.New(), segSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps, err := BuildStoreParallel(bytes.NewReader(data), HashSHA256, DomainNone, segSize, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ps.Root(), root) {
+		t.Fatal("parallel root differs from ProofTree root")
+	}
+
+	// a file is read in place, from its current offset
+	path := filepath.Join(t.TempDir(), "leaves")
+	if err := os.WriteFile(path, append(GenRandom(7), data...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Seek(7, io.SeekStart)
+	fs, err := BuildStoreParallel(f, HashSHA256, DomainNone, segSize, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fs.Root(), root) {
+		t.Fatal("root of a file differs")
+	}
+}
+
+func BenchmarkBuildStore(b *testing.B) {
+	for _, id := range []HashID{HashSHA256, HashMiMCBW6761} {
+		h, _ := id.New()
+		size := h.Size()
+		numLeaves := 1 << 12
+		data := make([]byte, 0, numLeaves*size)
+		for i := 0; i < numLeaves; i++ {
+			leaf := GenRandom(size)
+			leaf[0] = 0 // keep MiMC leaves below the modulus
+			data = append(data, leaf...)
+		}
+
+		for _, workers := range []int{1, 0} {
+			b.Run(fmt.Sprintf("%s/workers=%d", id, workers), func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					_, err := BuildStoreParallel(bytes.NewReader(data), id, DomainNone, size, 2, workers)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestMerkelConsistency(t *testing.T) {
+	numLeaves := 1<<5 + 5
+	data := GenRandom(numLeaves * segSize)
+
+	s, err := BuildStore(bytes.NewReader(data), HashSHA256, DomainNone, segSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := make([][]byte, numLeaves+1)
+	for n := 1; n <= numLeaves; n++ {
+		roots[n], err = s.RootAt(uint64(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, _ := ReaderRoot(bytes.NewReader(data[:n*segSize]), sha256.New(), segSize)
+		if !bytes.Equal(roots[n], root) {
+			t.Fatal("wrong root at size: ", n)
+		}
+	}
+
+	for m := 1; m <= numLeaves; m++ {
+		for n := m; n <= numLeaves; n++ {
+			proof, err := s.ProveConsistency(uint64(m), uint64(n))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyConsistency(sha256.New(), uint64(m), uint64(n), roots[m], roots[n], proof) {
+				t.Fatal("wrong consistency proof: ", m, n)
+			}
+
+			if n > m && VerifyConsistency(sha256.New(), uint64(m), uint64(n), roots[m], roots[n-1], proof) {
+				t.Fatal("consistency proof accepted against another root: ", m, n)
+			}
+			if m > 1 && VerifyConsistency(sha256.New(), uint64(m), uint64(n), roots[m-1], roots[n], proof) {
+				t.Fatal("consistency proof accepted from another root: ", m, n)
+			}
+			if len(proof) > 1 {
+				proof[len(proof)-1] = GenRandom(len(proof[0]))
+				if VerifyConsistency(sha256.New(), uint64(m), uint64(n), roots[m], roots[n], proof) {
+					t.Fatal("modified consistency proof accepted: ", m, n)
+				}
+			}
+		}
+	}
+
+	if _, err := s.ProveConsistency(3, uint64(numLeaves+1)); err == nil {
+		t.Fatal("proved consistency beyond the tree size")
+	}
+}
+
+func TestMerkelUpdateLeaf(t *testing.T) {
+	for _, arity := range []int{2, 3} {
+		for nc := 1; nc < 40; nc += 3 {
+			data := GenRandom(nc*segSize - 5)
+			s, err := BuildStoreArity(bytes.NewReader(data), HashSHA256, DomainNone, segSize, arity)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the last leaf is updated first, it is its own sibling for odd sizes
+			indices := []uint64{uint64(nc - 1), uint64(rand.Intn(nc)), uint64(rand.Intn(nc))}
+			for _, i := range indices {
+				leaf, _ := s.Leaf(i)
+				newLeaf := GenRandom(len(leaf))
+				oldRoot := s.Root()
+
+				newRoot, p, err := s.UpdateLeaf(i, newLeaf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				copy(data[int(i)*segSize:], newLeaf)
+				rebuilt, _ := BuildStoreArity(bytes.NewReader(data), HashSHA256, DomainNone, segSize, arity)
+				if !bytes.Equal(newRoot, rebuilt.Root()) || !bytes.Equal(p.OldRoot, oldRoot) {
+					t.Fatal("wrong root after update: ", arity, nc, i)
+				}
+				if !VerifyUpdateProof(sha256.New(), p) {
+					t.Fatal("wrong update proof: ", arity, nc, i)
+				}
+				if _, proofSet, _, _ := s.Prove(i); !VerifySizedProofArity(sha256.New(), arity, newRoot, proofSet, i, uint64(nc)) {
+					t.Fatal("wrong proof after update: ", arity, nc, i)
+				}
+
+				p.NewRoot = oldRoot
+				if VerifyUpdateProof(sha256.New(), p) {
+					t.Fatal("update proof accepted with a wrong root: ", arity, nc, i)
+				}
+			}
+
+			if _, _, err := s.UpdateLeaf(0, GenRandom(segSize+1)); err == nil {
+				t.Fatal("leaf size changed")
+			}
+			if _, _, err := s.UpdateLeaf(uint64(nc), GenRandom(segSize)); err == nil {
+				t.Fatal("updated a leaf out of range")
+			}
+		}
+	}
+}
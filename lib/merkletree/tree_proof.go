@@ -13,8 +13,8 @@ type ProofTree struct {
 	hash hash.Hash
 
 	currentIndex uint64
-	proofIndex   uint64
-	proofSet     [][]byte
+	proofIndices []uint64
+	proofSets    [][][]byte
 	proofTree    bool
 }
 
@@ -28,6 +28,9 @@ type subTree struct {
 func sum(h hash.Hash, data ...[]byte) []byte {
 	h.Reset()
 	for _, d := range data {
+		if len(d) == 0 {
+			continue
+		}
 		// the Hash interface specifies that Write never returns an error
 		_, err := h.Write(d)
 		if err != nil {
@@ -37,12 +40,26 @@ func sum(h hash.Hash, data ...[]byte) []byte {
 	return h.Sum(nil)
 }
 
+// leafSum returns the hash of a leaf, prefixed according to the domain of h.
 func leafSum(h hash.Hash, data []byte) []byte {
-	return sum(h, data)
+	return sum(h, prefix(h, leafTag), data)
 }
 
+// nodeSum returns the hash of two nodes, prefixed according to the domain of h.
 func nodeSum(h hash.Hash, a, b []byte) []byte {
-	return sum(h, a, b)
+	return sum(h, prefix(h, nodeTag), a, b)
+}
+
+// LeafSum returns the hash of a leaf as the trees of this package compute it,
+// for trees built on top of them such as lib/smt.
+func LeafSum(h hash.Hash, data []byte) []byte {
+	return leafSum(h, data)
+}
+
+// NodeSum returns the hash of two nodes as the trees of this package compute
+// it.
+func NodeSum(h hash.Hash, a, b []byte) []byte {
+	return nodeSum(h, a, b)
 }
 
 // joinSubTrees combines two equal sized subTrees into a larger subTree.
@@ -61,8 +78,10 @@ func New(h hash.Hash) *ProofTree {
 }
 
 func (t *ProofTree) Push(data []byte) {
-	if t.currentIndex == t.proofIndex {
-		t.proofSet = append(t.proofSet, data)
+	for k, index := range t.proofIndices {
+		if t.currentIndex == index {
+			t.proofSets[k] = append(t.proofSets[k], data)
+		}
 	}
 
 	t.head = &subTree{
@@ -77,23 +96,35 @@ func (t *ProofTree) Push(data []byte) {
 }
 
 func (t *ProofTree) SetIndex(i uint64) error {
+	return t.SetIndices([]uint64{i})
+}
+
+// SetIndices selects several leaves to prove. The proof sets of all of them
+// are collected while the data is pushed, so the data is read only once.
+func (t *ProofTree) SetIndices(indices []uint64) error {
 	if t.head != nil {
 		return errors.New("cannot call SetIndex on ProofTree if ProofTree has not been reset")
 	}
+	if len(indices) == 0 {
+		return errors.New("no proof index given")
+	}
 	t.proofTree = true
-	t.proofIndex = i
+	t.proofIndices = append([]uint64(nil), indices...)
+	t.proofSets = make([][][]byte, len(indices))
 	return nil
 }
 
 func (t *ProofTree) joinAllSubTrees() {
 	for t.head.next != nil && t.head.height == t.head.next.height {
-		if t.head.height == len(t.proofSet)-1 {
-			leaves := uint64(1 << uint(t.head.height))
-			mid := (t.currentIndex / leaves) * leaves
-			if t.proofIndex < mid {
-				t.proofSet = append(t.proofSet, t.head.sum)
-			} else {
-				t.proofSet = append(t.proofSet, t.head.next.sum)
+		for k, proofSet := range t.proofSets {
+			if t.head.height == len(proofSet)-1 {
+				leaves := uint64(1 << uint(t.head.height))
+				mid := (t.currentIndex / leaves) * leaves
+				if t.proofIndices[k] < mid {
+					t.proofSets[k] = append(proofSet, t.head.sum)
+				} else {
+					t.proofSets[k] = append(proofSet, t.head.next.sum)
+				}
 			}
 		}
 
@@ -101,7 +132,9 @@ func (t *ProofTree) joinAllSubTrees() {
 	}
 }
 
-func (t *ProofTree) joinAndFillSubTrees(h hash.Hash, a, b *subTree, proofSet [][]byte) (*subTree, [][]byte) {
+// joinAndFillSubTrees pads b up to the height of a by duplicating it, then
+// joins both. The nodes needed by every proof set are appended on the way.
+func (t *ProofTree) joinAndFillSubTrees(h hash.Hash, a, b *subTree, proofSets [][][]byte) *subTree {
 	nb := &subTree{
 		height: b.height,
 		sum:    make([]byte, len(b.sum)),
@@ -109,22 +142,24 @@ func (t *ProofTree) joinAndFillSubTrees(h hash.Hash, a, b *subTree, proofSet [][
 	copy(nb.sum, b.sum)
 
 	for nb.height < a.height {
-		//fmt.Printf("start: %d, height:%d, plen: %d\n", b.height, nb.height, len(proofSet)-1)
-		if nb.height == len(proofSet)-1 {
-			proofSet = append(proofSet, nb.sum)
+		for k, proofSet := range proofSets {
+			if nb.height == len(proofSet)-1 {
+				proofSets[k] = append(proofSet, nb.sum)
+			}
 		}
 		nb.sum = nodeSum(h, nb.sum, nb.sum)
 		nb.height++
 	}
 
-	//fmt.Printf("height:%d, plen: %d\n", nb.height, len(proofSet)-1)
-	if nb.height == len(proofSet)-1 {
-		leaves := uint64(1 << uint(nb.height))
-		mid := (t.currentIndex / leaves) * leaves
-		if t.proofIndex < mid {
-			proofSet = append(proofSet, nb.sum)
-		} else {
-			proofSet = append(proofSet, a.sum)
+	for k, proofSet := range proofSets {
+		if nb.height == len(proofSet)-1 {
+			leaves := uint64(1 << uint(nb.height))
+			mid := (t.currentIndex / leaves) * leaves
+			if t.proofIndices[k] < mid {
+				proofSets[k] = append(proofSet, nb.sum)
+			} else {
+				proofSets[k] = append(proofSet, a.sum)
+			}
 		}
 	}
 
@@ -132,7 +167,7 @@ func (t *ProofTree) joinAndFillSubTrees(h hash.Hash, a, b *subTree, proofSet [][
 		next:   a.next,
 		height: a.height + 1,
 		sum:    nodeSum(h, a.sum, nb.sum),
-	}, proofSet
+	}
 }
 
 func (t *ProofTree) Root() []byte {
@@ -141,7 +176,7 @@ func (t *ProofTree) Root() []byte {
 	}
 	current := t.head
 	for current.next != nil {
-		current, _ = t.joinAndFillSubTrees(t.hash, current.next, current, nil)
+		current = t.joinAndFillSubTrees(t.hash, current.next, current, nil)
 	}
 	// Return a copy to prevent leaking a pointer to internal data.
 	return append(current.sum[:0:0], current.sum...)
@@ -152,20 +187,32 @@ func (t *ProofTree) Prove() (merkleRoot []byte, proofSet [][]byte, proofIndex ui
 		panic("wrong usage: can't call prove on a tree if SetIndex wasn't called")
 	}
 
-	// Return nil if the ProofTree is empty, or if the proofIndex hasn't yet been
-	// reached.
-	if t.head == nil || len(t.proofSet) == 0 {
-		return t.Root(), nil, t.proofIndex, t.currentIndex
+	merkleRoot, proofSets, proofIndices, numLeaves := t.ProveMulti()
+	return merkleRoot, proofSets[0], proofIndices[0], numLeaves
+}
+
+// ProveMulti returns the proof sets of all indices given to SetIndices, in
+// the same order. A proof set is nil if its index hasn't yet been reached.
+func (t *ProofTree) ProveMulti() (merkleRoot []byte, proofSets [][][]byte, proofIndices []uint64, numLeaves uint64) {
+	if !t.proofTree {
+		panic("wrong usage: can't call prove on a tree if SetIndices wasn't called")
 	}
-	proofSet = t.proofSet
 
-	//fmt.Println("len: ", len(t.proofSet), len(proofSet))
+	proofSets = make([][][]byte, len(t.proofSets))
+	proofIndices = append([]uint64(nil), t.proofIndices...)
+	if t.head == nil {
+		return t.Root(), proofSets, proofIndices, t.currentIndex
+	}
+	for k, proofSet := range t.proofSets {
+		if len(proofSet) != 0 {
+			proofSets[k] = append([][]byte(nil), proofSet...)
+		}
+	}
 
 	current := t.head
 	for current.next != nil {
-		current, proofSet = t.joinAndFillSubTrees(t.hash, current.next, current, proofSet)
-		//fmt.Println("len: ", len(t.proofSet), len(proofSet))
+		current = t.joinAndFillSubTrees(t.hash, current.next, current, proofSets)
 	}
 
-	return current.sum, proofSet, t.proofIndex, t.currentIndex
+	return current.sum, proofSets, proofIndices, t.currentIndex
 }
@@ -0,0 +1,278 @@
+package merkletree
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash"
+	mbits "math/bits"
+	"sort"
+)
+
+const prtreeVersion = 1
+
+// PRTree is an RTree that also records the authentication paths of the
+// leaves registered with Track. Its frontier and the recorded paths can be
+// serialized, so that an append-only ingest can be checkpointed and resumed.
+type PRTree struct {
+	*RTree
+	paths map[uint64][][]byte // leaf index -> leaf data followed by siblings
+}
+
+func NewPRTree(h hash.Hash) *PRTree {
+	return &PRTree{
+		RTree: NewRTree(h),
+		paths: make(map[uint64][][]byte),
+	}
+}
+
+// Track registers a leaf whose proof will be answered by Prove. The leaf must
+// not have been pushed yet.
+func (t *PRTree) Track(i uint64) error {
+	if i < t.currentIndex {
+		return errors.New("cannot track a leaf that was already pushed")
+	}
+	if _, ok := t.paths[i]; !ok {
+		t.paths[i] = nil
+	}
+	return nil
+}
+
+func (t *PRTree) Push(data []byte) {
+	index := t.currentIndex
+	if _, ok := t.paths[index]; ok {
+		t.paths[index] = [][]byte{append([]byte(nil), data...)}
+	}
+
+	sum := leafSum(t.hash, data)
+	for i := 0; i < len(t.roots); i++ {
+		if t.roots[i].status {
+			if i == len(t.roots)-1 {
+				t.roots = append(t.roots, new(heightRoot))
+			}
+
+			// the subtree at height i ending with index is the right child
+			start := (index >> uint(i)) << uint(i)
+			for j, path := range t.paths {
+				if len(path) != i+1 {
+					continue
+				}
+				if j < start {
+					t.paths[j] = append(path, sum)
+				} else {
+					t.paths[j] = append(path, t.roots[i].sum)
+				}
+			}
+
+			sum = nodeSum(t.hash, t.roots[i].sum, sum)
+			t.roots[i].status = false
+		} else {
+			t.roots[i].sum = sum
+			t.roots[i].status = true
+			break
+		}
+	}
+
+	t.currentIndex++
+}
+
+// Prove returns the proof set of a tracked leaf against the current root, in
+// the form accepted by VerifyProof.
+func (t *PRTree) Prove(i uint64) (merkleRoot []byte, proofSet [][]byte, numLeaves uint64, err error) {
+	path, ok := t.paths[i]
+	if !ok {
+		return nil, nil, t.currentIndex, errors.New("leaf is not tracked")
+	}
+	if len(path) == 0 {
+		return nil, nil, t.currentIndex, errors.New("index was not reached while creating proof")
+	}
+
+	proofSet = append([][]byte(nil), path...)
+	height := len(path) - 1
+
+	// Complete the path the same way Root folds the frontier: the subtrees
+	// below the one holding the leaf form its right sibling, the ones above
+	// are left siblings, and missing ones are filled by duplication.
+	var root []byte
+	for j := 0; j < len(t.roots); j++ {
+		top := j == len(t.roots)-1
+		if t.roots[j].status {
+			if len(root) != 0 {
+				if j == height {
+					proofSet = append(proofSet, root)
+				} else if j > height {
+					proofSet = append(proofSet, t.roots[j].sum)
+				}
+				root = nodeSum(t.hash, t.roots[j].sum, root)
+			} else {
+				if !top {
+					if j == height {
+						proofSet = append(proofSet, t.roots[j].sum)
+					}
+					root = nodeSum(t.hash, t.roots[j].sum, t.roots[j].sum)
+				} else {
+					root = t.roots[j].sum
+				}
+			}
+		} else {
+			if len(root) != 0 {
+				if j > height {
+					proofSet = append(proofSet, root)
+				}
+				root = nodeSum(t.hash, root, root)
+			}
+		}
+	}
+
+	return root, proofSet, t.currentIndex, nil
+}
+
+// MarshalBinary encodes the frontier and all tracked paths.
+func (t *PRTree) MarshalBinary() ([]byte, error) {
+	hashSize := t.hash.Size()
+
+	buf := make([]byte, 0, 64)
+	buf = binary.BigEndian.AppendUint32(buf, prtreeVersion)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(hashSize))
+	buf = binary.BigEndian.AppendUint64(buf, t.currentIndex)
+
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(t.roots)))
+	for _, r := range t.roots {
+		if r.status {
+			if len(r.sum) != hashSize {
+				return nil, errors.New("unexpected sum size")
+			}
+			buf = append(buf, 1)
+			buf = append(buf, r.sum...)
+		} else {
+			buf = append(buf, 0)
+		}
+	}
+
+	indices := make([]uint64, 0, len(t.paths))
+	for i := range t.paths {
+		indices = append(indices, i)
+	}
+	sort.Slice(indices, func(a, b int) bool { return indices[a] < indices[b] })
+
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(indices)))
+	for _, i := range indices {
+		path := t.paths[i]
+		buf = binary.BigEndian.AppendUint64(buf, i)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(path)))
+		for _, p := range path {
+			buf = binary.BigEndian.AppendUint32(buf, uint32(len(p)))
+			buf = append(buf, p...)
+		}
+	}
+
+	return buf, nil
+}
+
+// UnmarshalBinary restores a tree encoded with MarshalBinary. The tree must
+// have been created with the same hash. The frontier must match the number
+// of leaves, and the paths their index: empty for leaves not pushed yet,
+// otherwise the leaf and the siblings up to its frontier subtree.
+func (t *PRTree) UnmarshalBinary(data []byte) error {
+	d := decoder{data: data}
+	if d.uint32() != prtreeVersion {
+		return errors.New("unsupported tree version")
+	}
+	hashSize := int(d.uint32())
+	if d.err == nil && hashSize != t.hash.Size() {
+		return errors.New("tree was built with another hash")
+	}
+	currentIndex := d.uint64()
+
+	// the frontier has a status per bit of the number of leaves
+	height := mbits.Len64(currentIndex)
+	if height == 0 {
+		height = 1
+	}
+	nroots := int(d.uint32())
+	if d.err == nil && nroots != height {
+		return errors.New("invalid tree height")
+	}
+	roots := make([]*heightRoot, nroots)
+	for i := range roots {
+		roots[i] = new(heightRoot)
+		switch d.bytes(1)[0] {
+		case 0:
+		case 1:
+			roots[i].status = true
+			roots[i].sum = d.bytes(hashSize)
+		default:
+			return errors.New("invalid frontier status")
+		}
+		if d.err == nil && roots[i].status != (currentIndex>>uint(i)&1 == 1) {
+			return errors.New("frontier doesn't match the leaf count")
+		}
+	}
+
+	npaths := int(d.uint32())
+	paths := make(map[uint64][][]byte)
+	for k := 0; k < npaths && d.err == nil; k++ {
+		i := d.uint64()
+		n := int(d.uint32())
+		if n > nroots {
+			return errors.New("invalid path length")
+		}
+		var path [][]byte
+		for j := 0; j < n; j++ {
+			path = append(path, d.bytes(int(d.uint32())))
+			if d.err == nil && j > 0 && len(path[j]) != hashSize {
+				return errors.New("invalid sibling size")
+			}
+		}
+		if d.err != nil {
+			break
+		}
+
+		want := 0
+		if i < currentIndex {
+			want = mbits.Len64(i ^ currentIndex)
+		}
+		if n != want {
+			return errors.New("path doesn't match the leaf index")
+		}
+		paths[i] = path
+	}
+
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.data) != 0 {
+		return errors.New("trailing data after tree")
+	}
+
+	t.roots = roots
+	t.currentIndex = currentIndex
+	t.paths = paths
+	return nil
+}
+
+// decoder reads big endian values and remembers the first error.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil || n < 0 || n > len(d.data) {
+		if d.err == nil {
+			d.err = errors.New("unexpected end of data")
+		}
+		// callers check err once at the end, keep them from indexing out of range
+		return make([]byte, 8)
+	}
+	b := append([]byte(nil), d.data[:n]...)
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) uint32() uint32 {
+	return binary.BigEndian.Uint32(d.bytes(4))
+}
+
+func (d *decoder) uint64() uint64 {
+	return binary.BigEndian.Uint64(d.bytes(8))
+}
@@ -4,8 +4,13 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"fmt"
+	gohash "hash"
 	"math/rand"
 	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+	"github.com/consensys/gnark-crypto/hash"
 )
 
 var segSize = 32
@@ -84,6 +89,87 @@ func TestMerkelProof(t *testing.T) {
 	}
 }
 
+func TestMerkelSizedProof(t *testing.T) {
+	data := GenRandom(segSize << depth)
+	for nc := 1; nc <= 1<<depth; nc++ {
+		numLeaves := uint64(nc)
+		for i := uint64(0); i < numLeaves; i++ {
+			root, proofSet, _, err := BuildReaderProof(bytes.NewReader(data[:nc*segSize]), sha256.New(), segSize, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifySizedProof(sha256.New(), root, proofSet, i, numLeaves) {
+				t.Fatal("wrong sized proof: ", nc, i)
+			}
+
+			// bits above the depth and the padding position of an odd last
+			// node are ignored by VerifyProof but not by VerifySizedProof
+			high := i + 1<<uint(len(proofSet)-1)
+			if !VerifyProof(sha256.New(), root, proofSet, high) {
+				t.Fatal("high index bits should pass VerifyProof: ", nc, i)
+			}
+			if nc > 1 && i == numLeaves-1 && i%2 == 0 && !VerifyProof(sha256.New(), root, proofSet, numLeaves) {
+				t.Fatal("padding index should pass VerifyProof: ", nc, i)
+			}
+			for _, alias := range []uint64{high, numLeaves} {
+				if VerifySizedProof(sha256.New(), root, proofSet, alias, numLeaves) {
+					t.Fatal("aliased index accepted: ", nc, i, alias)
+				}
+			}
+			if VerifySizedProof(sha256.New(), root, proofSet, i, numLeaves<<1) {
+				t.Fatal("proof accepted for a deeper tree: ", nc, i)
+			}
+
+			// dropping the last leaf of an even tree makes leaf i alone, its
+			// sibling then has to be itself
+			if nc%2 == 0 && i == numLeaves-2 && VerifySizedProof(sha256.New(), root, proofSet, i, numLeaves-1) {
+				t.Fatal("proof accepted for a smaller tree: ", nc, i)
+			}
+		}
+	}
+
+	// arity 4 pads the last node with copies of its last child
+	s, err := BuildStoreArity(bytes.NewReader(data[:6*segSize]), HashSHA256, DomainNone, segSize, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, proofSet, numLeaves, err := s.Prove(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySizedProofArity(sha256.New(), 4, root, proofSet, 4, numLeaves) {
+		t.Fatal("wrong sized arity proof")
+	}
+	for _, alias := range []uint64{6, 7} {
+		if VerifySizedProofArity(sha256.New(), 4, root, proofSet, alias, numLeaves) {
+			t.Fatal("aliased arity index accepted: ", alias)
+		}
+	}
+}
+
+func TestMerkelLegacyProof(t *testing.T) {
+	data := GenRandom(segSize << depth)
+	for nc := 1; nc <= 1<<depth; nc++ {
+		leaves := data[:nc*segSize]
+		root, err := Legacy_ReaderRoot(bytes.NewReader(leaves), sha256.New(), segSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := uint64(0); i < uint64(nc); i++ {
+			proofRoot, proofSet, numLeaves, err := Legacy_BuildReaderProof(bytes.NewReader(leaves), sha256.New(), segSize, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(proofRoot, root) {
+				t.Fatal("legacy proof root differs from legacy root: ", nc)
+			}
+			if !Legacy_VerifyProof(sha256.New(), root, proofSet, i, numLeaves) {
+				t.Fatal("wrong legacy proof: ", nc, i)
+			}
+		}
+	}
+}
+
 func TestMerkelRoot(t *testing.T) {
 	var numNodes = 1<<5 + 1<<4
 	fmt.Printf("nodes: %d\n", numNodes)
@@ -118,3 +204,399 @@ func TestBits(t *testing.T) {
 		t.Log(i, pi)
 	}
 }
+
+func TestMerkelMultiProof(t *testing.T) {
+	for nc := 1; nc < (1 << (depth + 1)); nc++ {
+		var buf bytes.Buffer
+		for i := 0; i < nc; i++ {
+			buf.Write(GenRandom(segSize))
+		}
+		data := buf.Bytes()
+
+		indices := []uint64{uint64(nc - 1), 0, uint64(nc / 2), uint64(nc / 3), 0}
+		root, proofSets, mp, err := BuildReaderMultiProof(bytes.NewReader(data), sha256.New(), segSize, indices)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for k, index := range indices {
+			proot, proofSet, _, err := BuildReaderProof(bytes.NewReader(data), sha256.New(), segSize, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(root, proot) || len(proofSet) != len(proofSets[k]) {
+				t.Fatal("multi proof differs from single proof at: ", index, nc)
+			}
+			for j := range proofSet {
+				if !bytes.Equal(proofSet[j], proofSets[k][j]) {
+					t.Fatal("multi proof differs from single proof at: ", index, nc)
+				}
+			}
+		}
+
+		if len(mp.Indices) > 4 {
+			t.Fatal("duplicated index in multi proof")
+		}
+		if !VerifyMultiProof(sha256.New(), root, mp) {
+			t.Fatal("wrong multi proof at: ", nc)
+		}
+
+		if len(mp.Hashes) > 0 {
+			mp.Hashes[0] = GenRandom(len(mp.Hashes[0]))
+			if VerifyMultiProof(sha256.New(), root, mp) {
+				t.Fatal("multi proof verified with modified hash at: ", nc)
+			}
+		}
+	}
+}
+
+func TestMerkelProveMultiCopy(t *testing.T) {
+	tree := New(sha256.New())
+	if err := tree.SetIndices([]uint64{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		tree.Push(GenRandom(segSize))
+	}
+
+	root, _, indices, _ := tree.ProveMulti()
+	indices[0] = 3
+	again, proofSets, indices, _ := tree.ProveMulti()
+	if indices[0] != 1 || !bytes.Equal(root, again) {
+		t.Fatal("proof indices changed through the returned slice")
+	}
+	if !VerifySizedProof(sha256.New(), root, proofSets[0], 1, 4) {
+		t.Fatal("proof broken through the returned slice")
+	}
+}
+
+func TestMerkelPRTree(t *testing.T) {
+	var numNodes = 1<<5 + 11
+	tracked := []uint64{0, 3, 16, 17, 31, 32, 40}
+
+	leaves := make([][]byte, numNodes)
+	for i := range leaves {
+		leaves[i] = GenRandom(segSize)
+	}
+
+	t1 := NewPRTree(sha256.New())
+	for _, i := range tracked {
+		if err := t1.Track(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for n := 0; n < numNodes; n++ {
+		// checkpoint and resume on every push
+		enc, err := t1.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t1 = NewPRTree(sha256.New())
+		if err := t1.UnmarshalBinary(enc); err != nil {
+			t.Fatal(err)
+		}
+
+		t1.Push(leaves[n])
+
+		for _, i := range tracked {
+			if i > uint64(n) {
+				if _, _, _, err := t1.Prove(i); err == nil {
+					t.Fatal("proved a leaf not pushed yet")
+				}
+				continue
+			}
+
+			tree := New(sha256.New())
+			tree.SetIndex(i)
+			for _, leaf := range leaves[:n+1] {
+				tree.Push(leaf)
+			}
+			root, proofSet, _, _ := tree.Prove()
+
+			proot, pproofSet, numLeaves, err := t1.Prove(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if numLeaves != uint64(n+1) || !bytes.Equal(root, proot) || !bytes.Equal(t1.Root(), root) {
+				t.Fatal("wrong root at: ", i, n)
+			}
+			if len(pproofSet) != len(proofSet) {
+				t.Fatal("wrong proof length at: ", i, n)
+			}
+			for k := range proofSet {
+				if !bytes.Equal(pproofSet[k], proofSet[k]) {
+					t.Fatal("wrong proof at: ", i, n)
+				}
+			}
+		}
+	}
+
+	if err := t1.Track(0); err == nil {
+		t.Fatal("tracked a leaf already pushed")
+	}
+	if _, _, _, err := t1.Prove(1); err == nil {
+		t.Fatal("proved an untracked leaf")
+	}
+
+	enc, _ := t1.MarshalBinary()
+	if err := NewPRTree(sha256.New()).UnmarshalBinary(enc[:len(enc)-1]); err == nil {
+		t.Fatal("decoded a truncated tree")
+	}
+}
+
+func TestMerkelPRTreeMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *PRTree)
+	}{
+		{"frontier", func(t *PRTree) {
+			t.roots[1].status = true
+			t.roots[1].sum = t.roots[0].sum
+		}},
+		{"height", func(t *PRTree) {
+			t.roots = append(t.roots, new(heightRoot))
+		}},
+		{"sibling", func(t *PRTree) {
+			t.paths[0][1] = t.paths[0][1][1:]
+		}},
+		{"path", func(t *PRTree) {
+			t.paths[0] = t.paths[0][:2]
+		}},
+		{"future", func(t *PRTree) {
+			t.paths[7] = [][]byte{GenRandom(segSize)}
+		}},
+	}
+
+	for _, tt := range tests {
+		// 5 leaves, the frontier holds subtrees of 4 and 1 leaves
+		t1 := NewPRTree(sha256.New())
+		for _, i := range []uint64{0, 7} {
+			if err := t1.Track(i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for n := 0; n < 5; n++ {
+			t1.Push(GenRandom(segSize))
+		}
+
+		enc, err := t1.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := NewPRTree(sha256.New()).UnmarshalBinary(enc); err != nil {
+			t.Fatal(err)
+		}
+
+		tt.tamper(t1)
+		enc, err = t1.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := NewPRTree(sha256.New()).UnmarshalBinary(enc); err == nil {
+			t.Fatal("decoded a malformed tree: ", tt.name)
+		}
+	}
+}
+
+func TestMerkelDomain(t *testing.T) {
+	mimcSize := hash.MIMC_BN254.New().Size()
+
+	hashes := []struct {
+		new   func() gohash.Hash
+		size  int
+		field bool
+	}{
+		{sha256.New, segSize, false},
+		{hash.MIMC_BN254.New, mimcSize, true},
+	}
+
+	for _, d := range []Domain{DomainNone, DomainRFC6962, DomainTagged} {
+		for _, hs := range hashes {
+			if d == DomainRFC6962 && hs.field {
+				// MiMC only consumes whole field elements
+				continue
+			}
+			newHash := func() gohash.Hash { return WithDomain(hs.new(), d) }
+			size := hs.size
+
+			var numNodes = 1<<4 + 3
+			var leaves [][]byte
+			t1 := New(newHash())
+			t1.SetIndex(uint64(numNodes - 2))
+			t2 := NewRTree(newHash())
+			for i := 0; i < numNodes; i++ {
+				b := GenRandom(size)
+				b[0] = 0 // keep MiMC leaves below the modulus
+				leaves = append(leaves, b)
+				t1.Push(b)
+				t2.Push(b)
+			}
+
+			root, proofSet, pindex, _ := t1.Prove()
+			if !bytes.Equal(root, t2.Root()) {
+				t.Fatal("unequal root with domain: ", d)
+			}
+			if !VerifyProof(newHash(), root, proofSet, pindex) {
+				t.Fatal("wrong merkle proof with domain: ", d)
+			}
+
+			if d != DomainNone {
+				plain := New(WithDomain(newHash(), DomainNone))
+				for _, b := range leaves {
+					plain.Push(b)
+				}
+				if bytes.Equal(plain.Root(), root) {
+					t.Fatal("domain doesn't change the root: ", d)
+				}
+			}
+		}
+	}
+
+	// a single leaf is hashed as H(0x00 || data) in RFC 6962
+	data := GenRandom(segSize)
+	t1 := New(WithDomain(sha256.New(), DomainRFC6962))
+	t1.Push(data)
+	expected := sha256.Sum256(append([]byte{0}, data...))
+	if !bytes.Equal(t1.Root(), expected[:]) {
+		t.Fatal("wrong RFC 6962 leaf hash")
+	}
+}
+
+func TestMerkelFieldProof(t *testing.T) {
+	for _, numNodes := range []int{1, 2, 5, 1<<depth + 3} {
+		leaves := make([]fr.Element, numNodes)
+		var buf bytes.Buffer
+		for i := range leaves {
+			leaves[i].SetRandom()
+			buf.Write(leaves[i].Marshal())
+		}
+		data := buf.Bytes()
+
+		root, err := FieldRoot(mimc.NewMiMC(), leaves)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := ReaderRoot(bytes.NewReader(data), mimc.NewMiMC(), fr.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(root.Marshal(), expected) {
+			t.Fatal("field root differs from reader root with leaves: ", numNodes)
+		}
+
+		indices := []uint64{0, uint64(numNodes - 1), uint64(numNodes / 2)}
+		proofs, err := BuildFieldMultiProof(mimc.NewMiMC(), leaves, indices)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, p := range proofs {
+			if p.Root != root || p.Index != indices[k] || p.NumLeaves != uint64(numNodes) {
+				t.Fatal("wrong field proof header")
+			}
+			if p.Path[0] != leaves[indices[k]] {
+				t.Fatal("wrong field proof leaf")
+			}
+			if !VerifyFieldProof(mimc.NewMiMC(), p) {
+				t.Fatal("field proof should verify: ", numNodes, indices[k])
+			}
+
+			var one fr.Element
+			one.SetOne()
+			p.Path[0].Add(&p.Path[0], &one)
+			if VerifyFieldProof(mimc.NewMiMC(), p) {
+				t.Fatal("field proof with wrong leaf should fail")
+			}
+		}
+	}
+
+	if _, err := FieldRoot(mimc.NewMiMC(), []fr.Element(nil)); err == nil {
+		t.Fatal("empty tree should have no root")
+	}
+	if _, err := BuildFieldProof(mimc.NewMiMC(), make([]fr.Element, 4), 4); err == nil {
+		t.Fatal("out of range index should fail")
+	}
+}
+
+func TestMerkelMMR(t *testing.T) {
+	const numLeaves = 45
+
+	m := NewMMR(sha256.New())
+	t1 := New(sha256.New())
+	leaves := make([][]byte, numLeaves)
+	for i := range leaves {
+		leaves[i] = GenRandom(segSize)
+		if m.Append(leaves[i]) != uint64(i) || !bytes.Equal(m.nodes[MMRPosition(uint64(i))], leafSum(m.hash, leaves[i])) {
+			t.Fatal("wrong leaf position: ", i)
+		}
+		t1.Push(leaves[i])
+
+		// a single mountain is a binary tree
+		n := uint64(i + 1)
+		if n&(n-1) == 0 && !bytes.Equal(m.Root(), t1.Root()) {
+			t.Fatal("unequal root at: ", i)
+		}
+	}
+
+	for n := uint64(1); n <= numLeaves; n++ {
+		peaks, _ := m.Peaks(n)
+		root := BagPeaks(m.hash, peaks)
+		for i := uint64(0); i < n; i++ {
+			p, err := m.Prove(i, leaves[i], n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyMMRProof(sha256.New(), root, p) {
+				t.Fatal("wrong proof: ", n, i)
+			}
+
+			// a proof of an earlier epoch is extended to the current peaks
+			np, err := m.ExtendProof(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyMMRProof(sha256.New(), m.Root(), np) {
+				t.Fatal("wrong extended proof: ", n, i)
+			}
+
+			// or by the path from its old peak, without the MMR
+			for n2 := n; n2 <= numLeaves; n2 += 7 {
+				e, err := m.ProveExtension(p, n2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				peaks, _ := m.Peaks(n2)
+				if !VerifyMMRExtension(sha256.New(), BagPeaks(m.hash, peaks), p, e) {
+					t.Fatal("wrong extension: ", n, i, n2)
+				}
+				if len(e.Path) > 0 {
+					e.Path[0] = leaves[0]
+					if VerifyMMRExtension(sha256.New(), BagPeaks(m.hash, peaks), p, e) {
+						t.Fatal("extension accepted with a wrong sibling: ", n, i, n2)
+					}
+				}
+			}
+
+			p.Leaf = leaves[(i+1)%n]
+			if n > 1 && VerifyMMRProof(sha256.New(), root, p) {
+				t.Fatal("proof accepted with a wrong leaf: ", n, i)
+			}
+		}
+	}
+
+	if _, err := m.Prove(3, leaves[4], numLeaves); err == nil {
+		t.Fatal("proved a wrong leaf")
+	}
+	if _, err := m.Prove(numLeaves, leaves[0], numLeaves); err == nil {
+		t.Fatal("proved an index out of range")
+	}
+
+	p, _ := m.Prove(3, leaves[3], 10)
+	if _, err := m.ProveExtension(p, 9); err == nil {
+		t.Fatal("extended a proof to fewer leaves")
+	}
+	p.Path = p.Path[1:]
+	if _, err := m.ExtendProof(p); err == nil {
+		t.Fatal("extended a proof with a short path")
+	}
+}
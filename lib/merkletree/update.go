@@ -0,0 +1,124 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+)
+
+// UpdateProof ties the root of a tree before one of its leaves was replaced
+// to the root after. The siblings of the leaf don't change with it, so the
+// same Path proves OldLeaf in OldRoot and NewLeaf in NewRoot. Proofs of
+// successive updates chain, the NewRoot of one being the OldRoot of the next.
+type UpdateProof struct {
+	Arity     int
+	Index     uint64
+	NumLeaves uint64
+	OldLeaf   []byte
+	NewLeaf   []byte
+	Path      [][]byte // siblings as in the proof set of Store.Prove, without the leaf
+	OldRoot   []byte
+	NewRoot   []byte
+}
+
+// UpdateLeaf replaces the data of the i-th leaf and rehashes its path to the
+// root. data must have the size of the leaf it replaces. It returns the new
+// root and the proof of the update. Stores opened with OpenStore are
+// read-only.
+func (s *Store) UpdateLeaf(i uint64, data []byte) (newRoot []byte, proof *UpdateProof, err error) {
+	if s.unmap != nil {
+		return nil, nil, errors.New("memory-mapped store is read-only")
+	}
+	if i >= s.numLeaves {
+		return nil, nil, errors.New("leaf index out of range")
+	}
+	if len(data) != len(s.leaf(i)) {
+		return nil, nil, errors.New("leaf size can't change")
+	}
+
+	oldRoot, proofSet, _, err := s.Prove(i)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	copy(s.leaf(i), data)
+	copy(s.node(0, i), leafSum(s.hash, s.leaf(i)))
+	arity := uint64(s.arity)
+	for height, j := 1, i/arity; height < len(s.offsets); height, j = height+1, j/arity {
+		copy(s.node(height, j), nodeSumN(s.hash, s.children(height-1, j)))
+	}
+
+	newRoot = s.Root()
+	proof = &UpdateProof{
+		Arity:     s.arity,
+		Index:     i,
+		NumLeaves: s.numLeaves,
+		OldLeaf:   proofSet[0],
+		NewLeaf:   append([]byte(nil), data...),
+		Path:      proofSet[1:],
+		OldRoot:   oldRoot,
+		NewRoot:   newRoot,
+	}
+	return newRoot, proof, nil
+}
+
+// updateRoot returns the root of the tree with leaf at index, given the
+// siblings of a proof. The siblings standing for missing children are
+// replaced by the child they copy, which is the node itself when it is the
+// last of its level. If strict, they must also equal it, as
+// VerifySizedProofArity requires.
+func updateRoot(h hash.Hash, p *UpdateProof, leaf []byte, strict bool) ([]byte, bool) {
+	arity := uint64(p.Arity)
+	if p.Arity < 2 || p.Index >= p.NumLeaves {
+		return nil, false
+	}
+	depth := TreeDepth(p.NumLeaves, p.Arity)
+	if len(p.Path) != depth*(p.Arity-1) {
+		return nil, false
+	}
+
+	path := p.Path
+	sum := leafSum(h, leaf)
+	i := p.Index
+	for height := 0; height < depth; height++ {
+		width := LevelWidth(p.NumLeaves, p.Arity, height)
+		base := i / arity * arity
+
+		children := make([][]byte, arity)
+		for j := range children {
+			if base+uint64(j) == i {
+				children[j] = sum
+			} else {
+				children[j], path = path[0], path[1:]
+			}
+		}
+		for j := range children {
+			if base+uint64(j) < width {
+				continue
+			}
+			last := children[width-1-base]
+			if strict && !bytes.Equal(children[j], last) {
+				return nil, false
+			}
+			children[j] = last
+		}
+
+		sum = nodeSumN(h, children)
+		i /= arity
+	}
+	return sum, true
+}
+
+// VerifyUpdateProof returns true if p replaces p.OldLeaf with p.NewLeaf at
+// p.Index, turning p.OldRoot into p.NewRoot.
+func VerifyUpdateProof(h hash.Hash, p *UpdateProof) bool {
+	if p == nil {
+		return false
+	}
+	oldRoot, ok := updateRoot(h, p, p.OldLeaf, true)
+	if !ok || !bytes.Equal(oldRoot, p.OldRoot) {
+		return false
+	}
+	newRoot, ok := updateRoot(h, p, p.NewLeaf, false)
+	return ok && bytes.Equal(newRoot, p.NewRoot)
+}
@@ -24,6 +24,9 @@ import (
 	"hash"
 )
 
+// VerifyProof doesn't know the size of the tree: index bits above the proof
+// length are ignored, and the duplicated last node of an odd level lets two
+// indices share a path. Use VerifySizedProof when the index must be canonical.
 func VerifyProof(h hash.Hash, merkleRoot []byte, proofSet [][]byte, proofIndex uint64) bool {
 	if len(proofSet) == 0 {
 		return false
@@ -40,3 +43,50 @@ func VerifyProof(h hash.Hash, merkleRoot []byte, proofSet [][]byte, proofIndex u
 
 	return bytes.Equal(sum, merkleRoot)
 }
+
+// VerifySizedProof is VerifyProof for a tree of numLeaves leaves. The index
+// must be below numLeaves, the proof set must have the depth of the tree and
+// the sibling of a node without one must be the node itself, so that a proof
+// set holds for a single index.
+func VerifySizedProof(h hash.Hash, merkleRoot []byte, proofSet [][]byte, proofIndex uint64, numLeaves uint64) bool {
+	return VerifySizedProofArity(h, 2, merkleRoot, proofSet, proofIndex, numLeaves)
+}
+
+// VerifySizedProofArity is VerifySizedProof for a tree whose nodes have arity
+// children: the missing children of the last node of a level must repeat its
+// last child.
+func VerifySizedProofArity(h hash.Hash, arity int, merkleRoot []byte, proofSet [][]byte, proofIndex uint64, numLeaves uint64) bool {
+	if arity < 2 || proofIndex >= numLeaves {
+		return false
+	}
+	depth := TreeDepth(numLeaves, arity)
+	if len(proofSet) != 1+depth*(arity-1) {
+		return false
+	}
+
+	sum := leafSum(h, proofSet[0])
+	children := make([][]byte, 0, arity)
+	for height := 0; height < depth; height++ {
+		siblings := proofSet[1+height*(arity-1) : 1+(height+1)*(arity-1)]
+		pos := int(proofIndex % uint64(arity))
+
+		children = children[:0]
+		children = append(children, siblings[:pos]...)
+		children = append(children, sum)
+		children = append(children, siblings[pos:]...)
+
+		first := proofIndex - uint64(pos)
+		if last := LevelWidth(numLeaves, arity, height) - 1; last < first+uint64(arity)-1 {
+			for j := last - first + 1; j < uint64(arity); j++ {
+				if !bytes.Equal(children[j], children[last-first]) {
+					return false
+				}
+			}
+		}
+
+		sum = nodeSumN(h, children)
+		proofIndex /= uint64(arity)
+	}
+
+	return bytes.Equal(sum, merkleRoot)
+}
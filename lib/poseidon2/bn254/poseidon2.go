@@ -0,0 +1,38 @@
+// Package bn254 provides Poseidon2 over the scalar field of BN254.
+package bn254
+
+import (
+	"hash"
+	"sync"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/yydfjt/gnark-example/lib/poseidon2"
+)
+
+var (
+	permOnce sync.Once
+	perm     *poseidon2.Permutation[fr.Element, *fr.Element]
+)
+
+func permutation() *poseidon2.Permutation[fr.Element, *fr.Element] {
+	permOnce.Do(func() {
+		p, err := poseidon2.ParametersFor(ecc.BN254)
+		if err != nil {
+			panic(err)
+		}
+		perm = poseidon2.NewPermutation[fr.Element](p)
+	})
+	return perm
+}
+
+// Permute applies the Poseidon2 permutation to the state in place.
+func Permute(state *[poseidon2.Width]fr.Element) {
+	permutation().Permute(state)
+}
+
+// NewPoseidon2 returns the Poseidon2 sponge hash. Like MiMC, it consumes
+// whole field elements and its sum is one element.
+func NewPoseidon2() hash.Hash {
+	return poseidon2.NewHasher(permutation())
+}
@@ -0,0 +1,135 @@
+// Package poseidon2 provides the Poseidon2 permutation and a sponge hash over
+// the scalar fields of BN254 and BLS12-377, natively and with the parameters
+// shared by the circuit in lib/poseidon2circuit.
+//
+// The state has 3 elements. Round constants are drawn from the Grain LFSR as
+// in the reference implementation, which gives the published BN254 instance
+// (d=5, 8 full and 56 partial rounds). BLS12-377 has no published instance:
+// it uses d=11, the smallest exponent coprime with r-1, and the round numbers
+// given for it by the bounds of the Poseidon2 paper at 128 bits of security,
+// margins included, which are 8 full and 37 partial rounds. The same bounds
+// give the round numbers of BN254.
+package poseidon2
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/consensys/gnark-crypto/ecc"
+)
+
+// Width is the number of field elements of the state.
+const Width = 3
+
+// Rate is the number of elements absorbed per permutation by the sponge.
+const Rate = Width - 1
+
+type Parameters struct {
+	Modulus       *big.Int
+	Degree        int // of the s-box x^Degree
+	FullRounds    int
+	PartialRounds int
+
+	// RoundConstants holds Width constants per full round and one per
+	// partial round, in the order they are added.
+	RoundConstants []*big.Int
+}
+
+// NewParameters derives the round constants of a Poseidon2 instance.
+func NewParameters(modulus *big.Int, degree, fullRounds, partialRounds int) *Parameters {
+	p := &Parameters{
+		Modulus:       new(big.Int).Set(modulus),
+		Degree:        degree,
+		FullRounds:    fullRounds,
+		PartialRounds: partialRounds,
+	}
+
+	n := modulus.BitLen()
+	g := newGrain(n, Width, fullRounds, partialRounds)
+	for i := 0; i < fullRounds*Width+partialRounds; i++ {
+		for {
+			c := g.bigInt(n)
+			if c.Cmp(modulus) < 0 {
+				p.RoundConstants = append(p.RoundConstants, c)
+				break
+			}
+		}
+	}
+	return p
+}
+
+var (
+	paramsOnce sync.Once
+	params     map[ecc.ID]*Parameters
+)
+
+// ParametersFor returns the parameters for the scalar field of curve.
+func ParametersFor(curve ecc.ID) (*Parameters, error) {
+	paramsOnce.Do(func() {
+		params = map[ecc.ID]*Parameters{
+			ecc.BN254:     NewParameters(ecc.BN254.ScalarField(), 5, 8, 56),
+			ecc.BLS12_377: NewParameters(ecc.BLS12_377.ScalarField(), 11, 8, 37),
+		}
+	})
+	if p, ok := params[curve]; ok {
+		return p, nil
+	}
+	return nil, errors.New("poseidon2 is not defined over this field")
+}
+
+// grain is the self-shrinking Grain LFSR used to generate constants.
+type grain struct {
+	state [80]byte
+}
+
+func newGrain(n, t, fullRounds, partialRounds int) *grain {
+	g := new(grain)
+	i := 0
+	put := func(v, bits int) {
+		for b := bits - 1; b >= 0; b-- {
+			g.state[i] = byte(v>>uint(b)) & 1
+			i++
+		}
+	}
+	put(1, 2) // prime field
+	put(0, 4) // x^d s-box
+	put(n, 12)
+	put(t, 12)
+	put(fullRounds, 10)
+	put(partialRounds, 10)
+	for ; i < len(g.state); i++ {
+		g.state[i] = 1
+	}
+
+	for j := 0; j < 160; j++ {
+		g.step()
+	}
+	return g
+}
+
+func (g *grain) step() byte {
+	s := &g.state
+	b := s[62] ^ s[51] ^ s[38] ^ s[23] ^ s[13] ^ s[0]
+	copy(s[:], s[1:])
+	s[len(s)-1] = b
+	return b
+}
+
+// bit returns the next output bit: bits are drawn in pairs and the second
+// one is kept only if the first one is set.
+func (g *grain) bit() byte {
+	for g.step() == 0 {
+		g.step()
+	}
+	return g.step()
+}
+
+func (g *grain) bigInt(n int) *big.Int {
+	x := new(big.Int)
+	for i := 0; i < n; i++ {
+		x.Lsh(x, 1)
+		x.SetBit(x, 0, uint(g.bit()))
+	}
+	return x
+}
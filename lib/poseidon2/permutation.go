@@ -0,0 +1,160 @@
+package poseidon2
+
+import (
+	"errors"
+	"math/big"
+)
+
+// Element is satisfied by the pointer to the fr.Element type of every curve
+// of gnark-crypto.
+type Element[E any] interface {
+	*E
+	Set(a *E) *E
+	Add(a, b *E) *E
+	Double(a *E) *E
+	Mul(a, b *E) *E
+	Square(a *E) *E
+	SetBigInt(*big.Int) *E
+	SetBytesCanonical([]byte) error
+	Marshal() []byte
+}
+
+// Permutation is the Poseidon2 permutation over the field of E.
+type Permutation[E any, PE Element[E]] struct {
+	params *Parameters
+	rc     []E
+}
+
+func NewPermutation[E any, PE Element[E]](p *Parameters) *Permutation[E, PE] {
+	perm := &Permutation[E, PE]{
+		params: p,
+		rc:     make([]E, len(p.RoundConstants)),
+	}
+	for i, c := range p.RoundConstants {
+		PE(&perm.rc[i]).SetBigInt(c)
+	}
+	return perm
+}
+
+// sbox sets x to x^Degree.
+func (perm *Permutation[E, PE]) sbox(x *E) {
+	var acc, sq E
+	PE(&acc).Set(x)
+	PE(&sq).Set(x)
+	d := perm.params.Degree
+	for d >>= 1; d > 0; d >>= 1 {
+		PE(&sq).Square(&sq)
+		if d&1 == 1 {
+			PE(&acc).Mul(&acc, &sq)
+		}
+	}
+	*x = acc
+}
+
+// external multiplies the state by circ(2, 1, 1).
+func external[E any, PE Element[E]](s *[Width]E) {
+	var sum E
+	PE(&sum).Add(&s[0], &s[1])
+	PE(&sum).Add(&sum, &s[2])
+	for i := range s {
+		PE(&s[i]).Add(&s[i], &sum)
+	}
+}
+
+// internal multiplies the state by diag(1, 1, 2) + 1.
+func internal[E any, PE Element[E]](s *[Width]E) {
+	var sum E
+	PE(&sum).Add(&s[0], &s[1])
+	PE(&sum).Add(&sum, &s[2])
+	PE(&s[2]).Double(&s[2])
+	for i := range s {
+		PE(&s[i]).Add(&s[i], &sum)
+	}
+}
+
+// Permute applies the permutation to the state in place.
+func (perm *Permutation[E, PE]) Permute(s *[Width]E) {
+	half := perm.params.FullRounds / 2
+	rc := perm.rc
+
+	full := func() {
+		for i := range s {
+			PE(&s[i]).Add(&s[i], &rc[i])
+			perm.sbox(&s[i])
+		}
+		rc = rc[Width:]
+		external[E, PE](s)
+	}
+
+	external[E, PE](s)
+	for r := 0; r < half; r++ {
+		full()
+	}
+	for r := 0; r < perm.params.PartialRounds; r++ {
+		PE(&s[0]).Add(&s[0], &rc[0])
+		perm.sbox(&s[0])
+		rc = rc[1:]
+		internal[E, PE](s)
+	}
+	for r := 0; r < half; r++ {
+		full()
+	}
+}
+
+// Hasher is a sponge over the permutation, with Rate elements absorbed per
+// call. The capacity element starts at the number of elements written, so
+// that messages of different lengths aren't confused by the zero padding of
+// the last block. Written data must be a sequence of canonical big endian
+// field elements.
+type Hasher[E any, PE Element[E]] struct {
+	perm *Permutation[E, PE]
+	size int
+	data []E
+}
+
+func NewHasher[E any, PE Element[E]](perm *Permutation[E, PE]) *Hasher[E, PE] {
+	var zero E
+	return &Hasher[E, PE]{
+		perm: perm,
+		size: len(PE(&zero).Marshal()),
+	}
+}
+
+func (h *Hasher[E, PE]) Write(p []byte) (int, error) {
+	if len(p)%h.size != 0 {
+		return 0, errors.New("invalid input length: must represent a list of field elements")
+	}
+	for i := 0; i < len(p); i += h.size {
+		var e E
+		if err := PE(&e).SetBytesCanonical(p[i : i+h.size]); err != nil {
+			return 0, err
+		}
+		h.data = append(h.data, e)
+	}
+	return len(p), nil
+}
+
+// Sum appends the hash of the elements written so far to b.
+func (h *Hasher[E, PE]) Sum(b []byte) []byte {
+	var s [Width]E
+	PE(&s[Rate]).SetBigInt(new(big.Int).SetInt64(int64(len(h.data))))
+	for i := 0; i < len(h.data) || i == 0; i += Rate {
+		for j := 0; j < Rate && i+j < len(h.data); j++ {
+			PE(&s[j]).Add(&s[j], &h.data[i+j])
+		}
+		h.perm.Permute(&s)
+	}
+	return append(b, PE(&s[0]).Marshal()...)
+}
+
+func (h *Hasher[E, PE]) Reset() {
+	h.data = h.data[:0]
+}
+
+func (h *Hasher[E, PE]) Size() int {
+	return h.size
+}
+
+func (h *Hasher[E, PE]) BlockSize() int {
+	return h.size
+}
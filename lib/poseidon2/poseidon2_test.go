@@ -0,0 +1,133 @@
+package poseidon2
+
+import (
+	"fmt"
+	"hash"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	bls377 "github.com/consensys/gnark-crypto/ecc/bls12-377/fr"
+	bls377mimc "github.com/consensys/gnark-crypto/ecc/bls12-377/fr/mimc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+)
+
+func TestPermutation(t *testing.T) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_377} {
+		p, err := ParametersFor(curve)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.RoundConstants) != p.FullRounds*Width+p.PartialRounds {
+			t.Fatalf("%s: wrong number of round constants: %d", curve, len(p.RoundConstants))
+		}
+
+		// the s-box is the smallest power that is a permutation
+		rMinus1 := new(big.Int).Sub(p.Modulus, big.NewInt(1))
+		for d := 3; d <= p.Degree; d++ {
+			coprime := new(big.Int).GCD(nil, nil, big.NewInt(int64(d)), rMinus1).Cmp(big.NewInt(1)) == 0
+			if coprime != (d == p.Degree) {
+				t.Fatalf("%s: x^%d is not the smallest permutation", curve, p.Degree)
+			}
+		}
+	}
+
+	p, err := ParametersFor(ecc.BN254)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test vector of the reference implementation for BN254
+	want := []string{
+		"0x0bb61d24daca55eebcb1929a82650f328134334da98ea4f847f760054f4a3033",
+		"0x303b6f7c86d043bfcbcc80214f26a30277a15d3f74ca654992defe7ff8d03570",
+		"0x1ed25194542b12eef8617361c3ba7c52e660b145994427cc86296242cf766ec8",
+	}
+	var s [Width]fr.Element
+	for i := range s {
+		s[i].SetUint64(uint64(i))
+	}
+	NewPermutation[fr.Element](p).Permute(&s)
+	for i := range s {
+		var w fr.Element
+		if _, err := w.SetString(want[i]); err != nil {
+			t.Fatal(err)
+		}
+		if !s[i].Equal(&w) {
+			t.Fatalf("state[%d] = %s, want %s", i, s[i].String(), w.String())
+		}
+	}
+
+	if _, err := ParametersFor(ecc.BW6_761); err == nil {
+		t.Fatal("poseidon2 should not be defined over bw6-761")
+	}
+}
+
+func TestHasher(t *testing.T) {
+	p, err := ParametersFor(ecc.BN254)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHasher(NewPermutation[fr.Element](p))
+
+	if _, err := h.Write(make([]byte, fr.Bytes+1)); err == nil {
+		t.Fatal("partial element should not be written")
+	}
+	modulus := ecc.BN254.ScalarField().FillBytes(make([]byte, fr.Bytes))
+	if _, err := h.Write(modulus); err == nil {
+		t.Fatal("non canonical element should not be written")
+	}
+
+	// messages only differing by trailing zeros have different hashes
+	sums := make(map[string]int)
+	for n := 0; n <= 4; n++ {
+		h.Reset()
+		if _, err := h.Write(make([]byte, n*fr.Bytes)); err != nil {
+			t.Fatal(err)
+		}
+		sum := h.Sum(nil)
+		if len(sum) != h.Size() {
+			t.Fatalf("wrong sum size %d", len(sum))
+		}
+		if m, ok := sums[string(sum)]; ok {
+			t.Fatalf("%d and %d zeros have the same hash", m, n)
+		}
+		sums[string(sum)] = n
+	}
+}
+
+// BenchmarkHash compares the native throughput of MiMC and Poseidon2 when
+// hashing two elements, as for a node of a Merkle tree.
+func BenchmarkHash(b *testing.B) {
+	bn254, err := ParametersFor(ecc.BN254)
+	if err != nil {
+		b.Fatal(err)
+	}
+	bls12377, err := ParametersFor(ecc.BLS12_377)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	hashes := []struct {
+		name string
+		h    hash.Hash
+	}{
+		{"mimc/bn254", mimc.NewMiMC()},
+		{"poseidon2/bn254", NewHasher(NewPermutation[fr.Element](bn254))},
+		{"mimc/bls12-377", bls377mimc.NewMiMC()},
+		{"poseidon2/bls12-377", NewHasher(NewPermutation[bls377.Element](bls12377))},
+	}
+	for _, c := range hashes {
+		b.Run(fmt.Sprintf("hash=%s", c.name), func(b *testing.B) {
+			data := make([]byte, 2*c.h.BlockSize())
+			data[len(data)-1] = 1
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				c.h.Reset()
+				c.h.Write(data)
+				c.h.Sum(nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Package poseidon2circuit provides the Poseidon2 sponge of lib/poseidon2 as
+// a circuit hash.FieldHasher.
+package poseidon2circuit
+
+import (
+	"errors"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/yydfjt/gnark-example/lib/poseidon2"
+)
+
+// Poseidon2 hashes the elements written with the same sponge as
+// poseidon2.Hasher, so its sum is the one of the native hash of the same
+// elements.
+type Poseidon2 struct {
+	api    frontend.API
+	params *poseidon2.Parameters
+	data   []frontend.Variable
+}
+
+// NewPoseidon2 returns a Poseidon2 instance over the field of api, which must
+// be the scalar field of BN254 or BLS12-377.
+func NewPoseidon2(api frontend.API) (Poseidon2, error) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_377} {
+		if api.Compiler().Field().Cmp(curve.ScalarField()) == 0 {
+			p, err := poseidon2.ParametersFor(curve)
+			if err != nil {
+				return Poseidon2{}, err
+			}
+			return Poseidon2{api: api, params: p}, nil
+		}
+	}
+	return Poseidon2{}, errors.New("poseidon2 is not defined over this field")
+}
+
+// Write adds more data to the running hash.
+func (h *Poseidon2) Write(data ...frontend.Variable) {
+	h.data = append(h.data, data...)
+}
+
+// Reset resets the Hash to its initial state.
+func (h *Poseidon2) Reset() {
+	h.data = nil
+}
+
+// Sum returns the hash of the data written since the last Reset.
+func (h *Poseidon2) Sum() frontend.Variable {
+	var s [poseidon2.Width]frontend.Variable
+	s[0], s[1], s[2] = 0, 0, len(h.data)
+	for i := 0; i < len(h.data) || i == 0; i += poseidon2.Rate {
+		for j := 0; j < poseidon2.Rate && i+j < len(h.data); j++ {
+			s[j] = h.api.Add(s[j], h.data[i+j])
+		}
+		h.Permute(&s)
+	}
+	return s[0]
+}
+
+// sbox returns x^Degree.
+func (h *Poseidon2) sbox(x frontend.Variable) frontend.Variable {
+	acc, sq := x, x
+	for d := h.params.Degree >> 1; d > 0; d >>= 1 {
+		sq = h.api.Mul(sq, sq)
+		if d&1 == 1 {
+			acc = h.api.Mul(acc, sq)
+		}
+	}
+	return acc
+}
+
+func (h *Poseidon2) external(s *[poseidon2.Width]frontend.Variable) {
+	sum := h.api.Add(s[0], s[1], s[2])
+	for i := range s {
+		s[i] = h.api.Add(s[i], sum)
+	}
+}
+
+func (h *Poseidon2) internal(s *[poseidon2.Width]frontend.Variable) {
+	sum := h.api.Add(s[0], s[1], s[2])
+	s[2] = h.api.Add(s[2], s[2])
+	for i := range s {
+		s[i] = h.api.Add(s[i], sum)
+	}
+}
+
+// Permute applies the permutation to the state in place.
+func (h *Poseidon2) Permute(s *[poseidon2.Width]frontend.Variable) {
+	half := h.params.FullRounds / 2
+	rc := h.params.RoundConstants
+
+	full := func() {
+		for i := range s {
+			s[i] = h.sbox(h.api.Add(s[i], rc[i]))
+		}
+		rc = rc[poseidon2.Width:]
+		h.external(s)
+	}
+
+	h.external(s)
+	for r := 0; r < half; r++ {
+		full()
+	}
+	for r := 0; r < h.params.PartialRounds; r++ {
+		s[0] = h.sbox(h.api.Add(s[0], rc[0]))
+		rc = rc[1:]
+		h.internal(s)
+	}
+	for r := 0; r < half; r++ {
+		full()
+	}
+}
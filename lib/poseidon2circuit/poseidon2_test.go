@@ -0,0 +1,112 @@
+package poseidon2circuit
+
+import (
+	"fmt"
+	"hash"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/hash/mimc"
+	"github.com/consensys/gnark/test"
+	p2bls377 "github.com/yydfjt/gnark-example/lib/poseidon2/bls12377"
+	p2bn254 "github.com/yydfjt/gnark-example/lib/poseidon2/bn254"
+)
+
+type testCircuit struct {
+	Data []frontend.Variable
+	Sum  frontend.Variable `gnark:",public"`
+}
+
+func (c *testCircuit) Define(api frontend.API) error {
+	h, err := NewPoseidon2(api)
+	if err != nil {
+		return err
+	}
+	h.Write(c.Data...)
+	api.AssertIsEqual(h.Sum(), c.Sum)
+	return nil
+}
+
+func TestPoseidon2(t *testing.T) {
+	curves := []struct {
+		id  ecc.ID
+		new func() hash.Hash
+	}{
+		{ecc.BN254, p2bn254.NewPoseidon2},
+		{ecc.BLS12_377, p2bls377.NewPoseidon2},
+	}
+	for _, c := range curves {
+		h := c.new()
+		for n := 1; n <= 5; n++ {
+			data := make([]frontend.Variable, n)
+			h.Reset()
+			for i := range data {
+				x := big.NewInt(int64(i + 1))
+				data[i] = x
+				h.Write(x.FillBytes(make([]byte, h.BlockSize())))
+			}
+
+			assignment := testCircuit{
+				Data: data,
+				Sum:  new(big.Int).SetBytes(h.Sum(nil)),
+			}
+			err := test.IsSolved(&testCircuit{Data: make([]frontend.Variable, n)}, &assignment, c.id.ScalarField())
+			if err != nil {
+				t.Fatalf("%s, %d elements: %v", c.id, n, err)
+			}
+
+			assignment.Sum = 0
+			err = test.IsSolved(&testCircuit{Data: make([]frontend.Variable, n)}, &assignment, c.id.ScalarField())
+			if err == nil {
+				t.Fatalf("%s, %d elements: wrong sum accepted", c.id, n)
+			}
+		}
+	}
+
+	err := test.IsSolved(&testCircuit{Data: make([]frontend.Variable, 1)}, &testCircuit{Data: []frontend.Variable{0}, Sum: 0}, ecc.BW6_761.ScalarField())
+	if err == nil {
+		t.Fatal("poseidon2 should not be defined over bw6-761")
+	}
+}
+
+type mimcCircuit testCircuit
+
+func (c *mimcCircuit) Define(api frontend.API) error {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	h.Write(c.Data...)
+	api.AssertIsEqual(h.Sum(), c.Sum)
+	return nil
+}
+
+// BenchmarkConstraints compares the constraint count of MiMC and Poseidon2
+// when hashing two elements, as for a node of a Merkle tree.
+func BenchmarkConstraints(b *testing.B) {
+	for _, curve := range []ecc.ID{ecc.BN254, ecc.BLS12_377} {
+		circuits := []struct {
+			name    string
+			circuit frontend.Circuit
+		}{
+			{"mimc", &mimcCircuit{Data: make([]frontend.Variable, 2)}},
+			{"poseidon2", &testCircuit{Data: make([]frontend.Variable, 2)}},
+		}
+		for _, c := range circuits {
+			b.Run(fmt.Sprintf("curve=%s/hash=%s", curve, c.name), func(b *testing.B) {
+				var nbConstraints int
+				for i := 0; i < b.N; i++ {
+					ccs, err := frontend.Compile(curve.ScalarField(), r1cs.NewBuilder, c.circuit)
+					if err != nil {
+						b.Fatal(err)
+					}
+					nbConstraints = ccs.GetNbConstraints()
+				}
+				b.ReportMetric(float64(nbConstraints), "constraints")
+			})
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Package smt provides a sparse Merkle tree keyed by field elements, with
+// membership and non-membership proofs.
+//
+// The path of a key is all of its bits (little endian, the lowest bit at the
+// leaf level), so the tree is as deep as the keys are wide and every key has
+// a leaf of its own. Leaves are the merkletree leaf hash of the value and
+// absent keys have an empty leaf of zero bytes; the empty subtrees above it
+// are precomputed, so that only the paths of the stored keys are kept.
+package smt
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"math/big"
+
+	"github.com/yydfjt/gnark-example/lib/merkletree"
+)
+
+var (
+	ErrKeyExists   = errors.New("key already exists")
+	ErrKeyNotFound = errors.New("key not found")
+)
+
+type Tree struct {
+	hash  hash.Hash
+	depth int
+	size  int // byte size of an encoded element
+
+	empty  [][]byte            // empty[i] is the root of an empty subtree of height i
+	nodes  map[string][]byte   // non-empty nodes, by height and key prefix
+	values map[string]*big.Int // by key
+}
+
+// Proof proves that Key is set to Value in the tree, or that Key is absent
+// and its leaf is empty.
+type Proof struct {
+	Key      *big.Int
+	Value    *big.Int
+	Exists   bool
+	Siblings [][]byte // from the leaf level to the root
+}
+
+// New returns an empty tree for keys of at most depth bits, such as 254 for
+// the elements of the BN254 scalar field. Keys and values are encoded big
+// endian on h.Size() bytes, as field elements for hashes such as MiMC.
+func New(h hash.Hash, depth int) (*Tree, error) {
+	size := h.Size()
+	if depth <= 0 || depth > 8*size {
+		return nil, errors.New("invalid tree depth")
+	}
+
+	t := &Tree{
+		hash:   h,
+		depth:  depth,
+		size:   size,
+		empty:  make([][]byte, depth+1),
+		nodes:  make(map[string][]byte),
+		values: make(map[string]*big.Int),
+	}
+	t.empty[0] = make([]byte, size)
+	for i := 1; i <= depth; i++ {
+		t.empty[i] = merkletree.NodeSum(h, t.empty[i-1], t.empty[i-1])
+	}
+	return t, nil
+}
+
+func leafSum(h hash.Hash, size int, value *big.Int) []byte {
+	return merkletree.LeafSum(h, encode(value, size))
+}
+
+// encode returns x big endian on size bytes.
+func encode(x *big.Int, size int) []byte {
+	return x.FillBytes(make([]byte, size))
+}
+
+func nodeID(height int, prefix *big.Int) string {
+	return string(append([]byte{byte(height >> 8), byte(height)}, prefix.Bytes()...))
+}
+
+// valid returns true if x can be encoded and written to h. Field hashes such
+// as MiMC reject elements that are not reduced.
+func valid(h hash.Hash, size int, x *big.Int) bool {
+	if x == nil || x.Sign() < 0 || x.BitLen() > 8*size {
+		return false
+	}
+	h.Reset()
+	_, err := h.Write(encode(x, size))
+	return err == nil
+}
+
+func (t *Tree) check(x *big.Int) error {
+	if !valid(t.hash, t.size, x) {
+		return errors.New("element out of range")
+	}
+	return nil
+}
+
+func (t *Tree) checkKey(key *big.Int) error {
+	if err := t.check(key); err != nil {
+		return err
+	}
+	if key.BitLen() > t.depth {
+		return errors.New("key wider than the tree depth")
+	}
+	return nil
+}
+
+// node returns the node at the given height above the key prefix.
+func (t *Tree) node(height int, prefix *big.Int) []byte {
+	if n, ok := t.nodes[nodeID(height, prefix)]; ok {
+		return n
+	}
+	return t.empty[height]
+}
+
+// Root returns the root of the tree.
+func (t *Tree) Root() []byte {
+	return append([]byte(nil), t.node(t.depth, new(big.Int))...)
+}
+
+// Get returns the value stored for key.
+func (t *Tree) Get(key *big.Int) (*big.Int, bool) {
+	value, ok := t.values[string(key.Bytes())]
+	if !ok {
+		return nil, false
+	}
+	return new(big.Int).Set(value), true
+}
+
+// Insert adds a new key to the tree.
+func (t *Tree) Insert(key, value *big.Int) error {
+	if err := t.checkKey(key); err != nil {
+		return err
+	}
+	if err := t.check(value); err != nil {
+		return err
+	}
+	if _, ok := t.values[string(key.Bytes())]; ok {
+		return ErrKeyExists
+	}
+
+	t.set(key, value)
+	return nil
+}
+
+// Update changes the value of an existing key.
+func (t *Tree) Update(key, value *big.Int) error {
+	if err := t.check(value); err != nil {
+		return err
+	}
+	if _, ok := t.Get(key); !ok {
+		return ErrKeyNotFound
+	}
+
+	t.set(key, value)
+	return nil
+}
+
+// set stores the leaf of key and recomputes its path up to the root.
+func (t *Tree) set(key, value *big.Int) {
+	t.values[string(key.Bytes())] = new(big.Int).Set(value)
+
+	sum := leafSum(t.hash, t.size, value)
+	t.nodes[nodeID(0, key)] = sum
+
+	prefix := new(big.Int).Set(key)
+	for height := 0; height < t.depth; height++ {
+		sibling := t.node(height, new(big.Int).Xor(prefix, big.NewInt(1)))
+		if prefix.Bit(0) == 1 {
+			sum = merkletree.NodeSum(t.hash, sibling, sum)
+		} else {
+			sum = merkletree.NodeSum(t.hash, sum, sibling)
+		}
+		prefix.Rsh(prefix, 1)
+		t.nodes[nodeID(height+1, prefix)] = sum
+	}
+}
+
+// Prove returns a membership proof if key is in the tree, and a
+// non-membership proof otherwise.
+func (t *Tree) Prove(key *big.Int) (*Proof, error) {
+	if err := t.checkKey(key); err != nil {
+		return nil, err
+	}
+
+	p := &Proof{
+		Key: new(big.Int).Set(key),
+	}
+	if value, ok := t.Get(key); ok {
+		p.Exists = true
+		p.Value = value
+	}
+
+	prefix := new(big.Int).Set(key)
+	for height := 0; height < t.depth; height++ {
+		sibling := t.node(height, new(big.Int).Xor(prefix, big.NewInt(1)))
+		p.Siblings = append(p.Siblings, append([]byte(nil), sibling...))
+		prefix.Rsh(prefix, 1)
+	}
+
+	return p, nil
+}
+
+// VerifyProof returns true if p is a valid membership or non-membership
+// proof against root. The tree depth is the length of the path.
+func VerifyProof(h hash.Hash, root []byte, p *Proof) bool {
+	if p == nil || p.Key == nil || len(p.Siblings) == 0 {
+		return false
+	}
+	size := h.Size()
+	depth := len(p.Siblings)
+	if depth > 8*size || p.Key.BitLen() > depth || !valid(h, size, p.Key) {
+		return false
+	}
+
+	sum := make([]byte, size)
+	if p.Exists {
+		if !valid(h, size, p.Value) {
+			return false
+		}
+		sum = leafSum(h, size, p.Value)
+	}
+
+	for i, sibling := range p.Siblings {
+		if p.Key.Bit(i) == 1 {
+			sum = merkletree.NodeSum(h, sibling, sum)
+		} else {
+			sum = merkletree.NodeSum(h, sum, sibling)
+		}
+	}
+
+	return bytes.Equal(sum, root)
+}
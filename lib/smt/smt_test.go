@@ -0,0 +1,143 @@
+package smt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/hash"
+)
+
+// depth is the bit length of the BN254 scalar field
+var depth = 254
+
+func TestSparseTree(t *testing.T) {
+	mod := ecc.BN254.ScalarField()
+
+	tree, err := New(hash.MIMC_BN254.New(), depth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emptyRoot := tree.Root()
+
+	var keys []*big.Int
+	for i := 0; i < 20; i++ {
+		key, _ := rand.Int(rand.Reader, mod)
+		value, _ := rand.Int(rand.Reader, mod)
+		if err := tree.Insert(key, value); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		p, err := tree.Prove(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.Exists || !VerifyProof(hash.MIMC_BN254.New(), tree.Root(), p) {
+			t.Fatal("wrong membership proof")
+		}
+		if VerifyProof(hash.MIMC_BN254.New(), emptyRoot, p) {
+			t.Fatal("membership proof accepted against another root")
+		}
+
+		p.Value.Add(p.Value, big.NewInt(1))
+		if VerifyProof(hash.MIMC_BN254.New(), tree.Root(), p) {
+			t.Fatal("membership proof accepted with a wrong value")
+		}
+	}
+
+	if err := tree.Insert(keys[0], big.NewInt(1)); err != ErrKeyExists {
+		t.Fatal("inserted an existing key")
+	}
+
+	// absent key
+	absent, _ := rand.Int(rand.Reader, mod)
+	p, err := tree.Prove(absent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Exists || !VerifyProof(hash.MIMC_BN254.New(), tree.Root(), p) {
+		t.Fatal("wrong non-membership proof")
+	}
+
+	// a key sharing the low 252 bits of a member, below 2²⁵³ to stay in
+	// the field
+	near := new(big.Int).SetBit(keys[1], 252, 1-keys[1].Bit(252))
+	near.SetBit(near, 253, 0)
+	p, err = tree.Prove(near)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Exists || !VerifyProof(hash.MIMC_BN254.New(), tree.Root(), p) {
+		t.Fatal("wrong non-membership proof for a key near a member")
+	}
+	if err := tree.Insert(near, big.NewInt(1)); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = tree.Prove(keys[1])
+	if !p.Exists || !VerifyProof(hash.MIMC_BN254.New(), tree.Root(), p) {
+		t.Fatal("member lost after inserting a key near it")
+	}
+
+	// a member can't be proven absent
+	p, _ = tree.Prove(keys[2])
+	p.Exists = false
+	if VerifyProof(hash.MIMC_BN254.New(), tree.Root(), p) {
+		t.Fatal("non-membership proof accepted for a member")
+	}
+
+	root := tree.Root()
+	if err := tree.Update(keys[3], big.NewInt(7)); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := tree.Get(keys[3]); !ok || value.Int64() != 7 {
+		t.Fatal("wrong updated value")
+	}
+	p, _ = tree.Prove(keys[3])
+	if !VerifyProof(hash.MIMC_BN254.New(), tree.Root(), p) || VerifyProof(hash.MIMC_BN254.New(), root, p) {
+		t.Fatal("wrong proof after update")
+	}
+	if err := tree.Update(absent, big.NewInt(7)); err != ErrKeyNotFound {
+		t.Fatal("updated an absent key")
+	}
+
+	if err := tree.Insert(mod, big.NewInt(1)); err == nil {
+		t.Fatal("inserted a key out of the field")
+	}
+
+	narrow, _ := New(hash.MIMC_BN254.New(), 16)
+	if err := narrow.Insert(big.NewInt(1<<16), big.NewInt(1)); err == nil {
+		t.Fatal("inserted a key wider than the tree")
+	}
+}
+
+func TestSparseTreeOrder(t *testing.T) {
+	// the root only depends on the content, not on the insertion order
+	t1, _ := New(sha256.New(), depth)
+	t2, _ := New(sha256.New(), depth)
+
+	var keys []*big.Int
+	for i := 0; i < 10; i++ {
+		// distinct keys, sharing their low bits
+		key := new(big.Int).Lsh(big.NewInt(int64(i)), 200)
+		keys = append(keys, key.Add(key, big.NewInt(5)))
+	}
+
+	for i := range keys {
+		if err := t1.Insert(keys[i], big.NewInt(int64(i))); err != nil {
+			t.Fatal(err)
+		}
+		j := len(keys) - 1 - i
+		if err := t2.Insert(keys[j], big.NewInt(int64(j))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if string(t1.Root()) != string(t2.Root()) {
+		t.Fatal("root depends on insertion order")
+	}
+}
@@ -0,0 +1,59 @@
+package smtcircuit
+
+import (
+	"math/big"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash"
+	"github.com/consensys/gnark/std/math/bits"
+	"github.com/yydfjt/gnark-example/lib/merklecircuit"
+	"github.com/yydfjt/gnark-example/lib/smt"
+)
+
+// Depth is the bit length of the BN254 scalar field, so that every key of
+// the field has a path of its own. Trees must be built with smt.New(h, Depth).
+const Depth = 254
+
+// Proof is a membership or non-membership proof of lib/smt.
+type Proof struct {
+	Key   frontend.Variable
+	Value frontend.Variable
+
+	Siblings [Depth]frontend.Variable
+}
+
+// Assign sets the proof from a native proof of a tree of depth Depth.
+func (p *Proof) Assign(np *smt.Proof) {
+	p.Key = np.Key
+	p.Value = 0
+	if np.Exists {
+		p.Value = np.Value
+	}
+	for i := range p.Siblings {
+		p.Siblings[i] = new(big.Int).SetBytes(np.Siblings[i])
+	}
+}
+
+// root walks from the leaf up to the root along the bits of the key. The
+// decomposition is canonical, so a key has a single path.
+func (p *Proof) root(api frontend.API, h hash.FieldHasher, sum frontend.Variable) frontend.Variable {
+	keyBits := bits.ToBinary(api, p.Key, bits.WithNbDigits(Depth))
+	for i := 0; i < Depth; i++ {
+		d1 := api.Select(keyBits[i], p.Siblings[i], sum)
+		d2 := api.Select(keyBits[i], sum, p.Siblings[i])
+		sum = merklecircuit.NodeSum(api, h, d1, d2)
+	}
+	return sum
+}
+
+// VerifyMembership asserts that Key is set to Value under root.
+func (p *Proof) VerifyMembership(api frontend.API, h hash.FieldHasher, root frontend.Variable) {
+	sum := merklecircuit.LeafSum(api, h, p.Value)
+	api.AssertIsEqual(p.root(api, h, sum), root)
+}
+
+// VerifyNonMembership asserts that Key is absent under root, that is its
+// leaf is empty. Value is ignored.
+func (p *Proof) VerifyNonMembership(api frontend.API, h hash.FieldHasher, root frontend.Variable) {
+	api.AssertIsEqual(p.root(api, h, 0), root)
+}
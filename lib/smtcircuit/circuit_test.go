@@ -0,0 +1,81 @@
+package smtcircuit
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/hash"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash/mimc"
+	"github.com/consensys/gnark/test"
+	"github.com/yydfjt/gnark-example/lib/smt"
+)
+
+type testCircuit struct {
+	P      Proof
+	Root   frontend.Variable `gnark:",public"`
+	Member bool              `gnark:"-"`
+}
+
+func (c *testCircuit) Define(api frontend.API) error {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	if c.Member {
+		c.P.VerifyMembership(api, &h, c.Root)
+	} else {
+		c.P.VerifyNonMembership(api, &h, c.Root)
+	}
+	return nil
+}
+
+func TestSparseProof(t *testing.T) {
+	field := ecc.BN254.ScalarField()
+
+	tree, err := smt.New(hash.MIMC_BN254.New(), Depth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []*big.Int
+	for i := 0; i < 8; i++ {
+		key, _ := rand.Int(rand.Reader, field)
+		if err := tree.Insert(key, big.NewInt(int64(i))); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	absent, _ := rand.Int(rand.Reader, field)
+	// a key sharing the low 252 bits of a member, below 2²⁵³ to stay in
+	// the field
+	near := new(big.Int).SetBit(keys[0], 252, 1-keys[0].Bit(252))
+	near.SetBit(near, 253, 0)
+
+	check := func(key *big.Int, member bool, ok bool) {
+		np, err := tree.Prove(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var assignment testCircuit
+		assignment.P.Assign(np)
+		assignment.Root = tree.Root()
+		err = test.IsSolved(&testCircuit{Member: member}, &assignment, field)
+		if ok && err != nil {
+			t.Fatal(err)
+		}
+		if !ok && err == nil {
+			t.Fatal("invalid proof accepted for: ", key, member)
+		}
+	}
+
+	check(keys[1], true, true)
+	check(absent, false, true)
+	check(near, false, true)
+
+	check(keys[1], false, false)
+	check(absent, true, false)
+	check(near, true, false)
+}
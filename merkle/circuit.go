@@ -1,80 +1,112 @@
 package main
 
 import (
-	"bytes"
-	"crypto/rand"
+	"flag"
 	"fmt"
 
-	"github.com/yydfjt/gnark-example/lib/merkletree"
-
 	"github.com/consensys/gnark-crypto/ecc"
-	"github.com/consensys/gnark-crypto/hash"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
 	"github.com/consensys/gnark/backend/witness"
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/std/hash/mimc"
 	"github.com/yydfjt/gnark-example/lib/merklecircuit"
+	"github.com/yydfjt/gnark-example/lib/merkletree"
 )
 
 var curveID = ecc.BN254
-var hashID = hash.MIMC_BN254
 
-const (
-	Depth = 5
+var (
+	numNodes   = flag.Int("leaves", 1<<5+8, "number of leaves of the tree")
+	proofIndex = flag.Int("index", 1<<5+5, "index of the proven leaf")
+	hashName   = flag.String("hash", "mimc", "hash of the tree: mimc or poseidon2")
 )
 
-var numNodes = 1<<5 + 8
-var proofIndex = 1<<5 + 5
+var hashIDs = map[string]merkletree.HashID{
+	"mimc":      merkletree.HashMiMCBN254,
+	"poseidon2": merkletree.HashPoseidon2BN254,
+}
+
+// hashID returns the hash selected with -hash.
+func hashID() (merkletree.HashID, error) {
+	id, ok := hashIDs[*hashName]
+	if !ok {
+		return 0, fmt.Errorf("unknown hash %q", *hashName)
+	}
+	return id, nil
+}
 
 var depth int
 
+// Circuit proves a leaf of the tree of NumLeaves leaves with the given root.
+// The size is public, see merklecircuit.Circuit.NumLeaves.
 type Circuit struct {
-	M    merklecircuit.Circuit
-	Root frontend.Variable `gnark:",public"`
+	M         merklecircuit.Circuit
+	Root      frontend.Variable `gnark:",public"`
+	NumLeaves frontend.Variable `gnark:",public"`
+	Hash      merkletree.HashID `gnark:"-"`
 }
 
 func (circuit *Circuit) Define(api frontend.API) error {
-	h, err := mimc.NewMiMC(api)
+	h, err := merklecircuit.NewHasher(api, circuit.Hash)
 	if err != nil {
 		return err
 	}
-	circuit.M.VerifyProof(api, &h, circuit.Root)
+	api.AssertIsEqual(circuit.M.NumLeaves, circuit.NumLeaves)
+	circuit.M.VerifyProof(api, h, circuit.Root)
 
 	return nil
 }
 
 func GenWithness() (witness.Witness, error) {
-	var buf bytes.Buffer
-
-	mod := curveID.ScalarField()
-	fieldSize := len(mod.Bytes())
+	id, err := hashID()
+	if err != nil {
+		return nil, err
+	}
+	h, err := id.New()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("nodes: %d, field size: %d, hash: %s\n", *numNodes, fr.Bytes, id)
 
-	fmt.Printf("nodes: %d, field size: %d\n", numNodes, fieldSize)
+	leaves := make([]fr.Element, *numNodes)
+	for i := range leaves {
+		leaves[i].SetRandom()
+	}
 
-	for i := 0; i < numNodes; i++ {
-		leaf, _ := rand.Int(rand.Reader, mod)
-		b := leaf.Bytes()
-		buf.Write(make([]byte, fieldSize-len(b)))
-		buf.Write(b)
+	fp, err := merkletree.BuildFieldProof(h, leaves, uint64(*proofIndex))
+	if err != nil {
+		return nil, err
 	}
 
-	merkleRoot, merkleProof, _, err := merkletree.BuildReaderProof(&buf, hashID.New(), fieldSize, uint64(proofIndex))
+	// the proof is encoded by the prover and decoded by the auditor
+	proofSet := make([][]byte, len(fp.Path))
+	for i := range fp.Path {
+		proofSet[i] = fp.Path[i].Marshal()
+	}
+	data, err := merkletree.NewMerkleProof(id, fr.Bytes, fp.Index, fp.NumLeaves, proofSet).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	var proof merkletree.MerkleProof
+	err = proof.UnmarshalBinary(data)
 	if err != nil {
 		return nil, err
 	}
 
-	verified := merkletree.VerifyProof(hashID.New(), merkleRoot, merkleProof, uint64(proofIndex))
+	verified := proof.Verify(fp.Root.Marshal())
 	if !verified {
 		fmt.Printf("The merkle proof in plain go should pass")
 	}
 
-	depth = len(merkleProof)
-	fmt.Printf("pindex:%d, depth: %d\n", proofIndex, depth)
+	depth = len(proof.Path) - 1
+	fmt.Printf("pindex:%d, depth: %d, proof size: %d\n", proof.Index, depth, len(data))
 
-	var assignment Circuit
-	assignment.Root = merkleRoot
-	assignment.M.Leaf = proofIndex
-	for i := 0; i < depth; i++ {
-		assignment.M.Path[i] = merkleProof[i]
+	assignment := Circuit{M: merklecircuit.New(depth)}
+	assignment.Root = fp.Root
+	assignment.NumLeaves = proof.NumLeaves
+	assignment.M.Leaf = proof.Index
+	assignment.M.NumLeaves = proof.NumLeaves
+	for i := range proof.Path {
+		assignment.M.Path[i] = proof.Path[i]
 	}
 
 	witness, err := frontend.NewWitness(&assignment, curveID.ScalarField())
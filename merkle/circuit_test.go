@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/test"
+	"github.com/yydfjt/gnark-example/lib/merklecircuit"
+	"github.com/yydfjt/gnark-example/lib/merkletree"
+	"github.com/yydfjt/gnark-example/lib/merkletree/bn254"
+)
+
+func TestCircuitPadding(t *testing.T) {
+	const numLeaves = 5
+	leaves := make([]fr.Element, numLeaves)
+	for i := range leaves {
+		leaves[i].SetRandom()
+	}
+
+	// the last leaf of an odd tree is its own sibling, so its path is also
+	// the path of the padding slot of a tree of one more leaf
+	proof, err := bn254.BuildProof(leaves, numLeaves-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	depth := len(proof.Path) - 1
+
+	check := func(leaf, size, publicSize uint64, ok bool) {
+		assignment := Circuit{M: merklecircuit.New(depth)}
+		if err := merklecircuit.Assign(&assignment.M, proof); err != nil {
+			t.Fatal(err)
+		}
+		assignment.Root = proof.Root
+		assignment.M.Leaf = leaf
+		assignment.M.NumLeaves = size
+		assignment.NumLeaves = publicSize
+
+		circuit := Circuit{M: merklecircuit.New(depth), Hash: merkletree.HashMiMCBN254}
+		err := test.IsSolved(&circuit, &assignment, curveID.ScalarField())
+		if (err == nil) != ok {
+			t.Fatal(leaf, size, publicSize, err)
+		}
+	}
+
+	check(numLeaves-1, numLeaves, numLeaves, true)
+	// the padding slot only passes for the claim of a larger tree
+	check(numLeaves, numLeaves+1, numLeaves+1, true)
+	check(numLeaves, numLeaves+1, numLeaves, false)
+	check(numLeaves, numLeaves, numLeaves, false)
+}
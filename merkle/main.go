@@ -1,21 +1,31 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 
 	"github.com/consensys/gnark/backend/groth16"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/yydfjt/gnark-example/lib/merklecircuit"
 )
 
 func main() {
+	flag.Parse()
+
 	witness, err := GenWithness()
 	if err != nil {
 		fmt.Printf("create witness fail: %s\n", err)
 		return
 	}
 
-	var circuit Circuit
+	id, err := hashID()
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return
+	}
+
+	circuit := Circuit{M: merklecircuit.New(depth), Hash: id}
 	r1cs, err := frontend.Compile(curveID.ScalarField(), r1cs.NewBuilder, &circuit)
 	if err != nil {
 		fmt.Printf("compile fail: %v\n", err)
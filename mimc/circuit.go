@@ -1,17 +1,18 @@
 package main
 
 import (
+	"flag"
 	"math/big"
 
 	"github.com/consensys/gnark-crypto/ecc"
 	bls12377 "github.com/consensys/gnark-crypto/ecc/bls12-377"
 	"github.com/consensys/gnark-crypto/ecc/bls12-377/fr"
-	"github.com/consensys/gnark-crypto/ecc/bls12-377/kzg"
 	"github.com/consensys/gnark-crypto/hash"
 	"github.com/consensys/gnark/backend/witness"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std/algebra/native/sw_bls12377"
 	"github.com/consensys/gnark/std/hash/mimc"
+	"github.com/yydfjt/gnark-example/lib/kzg"
 )
 
 const InputSize = 10
@@ -19,6 +20,8 @@ const InputSize = 10
 var curveID = ecc.BW6_761
 var hashID = hash.MIMC_BW6_761
 
+var srsPath = flag.String("srs", "", "file of a ceremony SRS, a throwaway key is generated if empty")
+
 type Circuit struct {
 	Value [InputSize]frontend.Variable
 	G1    [InputSize - 1]sw_bls12377.G1Affine // omit first one is G1 one
@@ -46,8 +49,7 @@ func (circuit *Circuit) Define(api frontend.API) error {
 func GenWithness() (witness.Witness, error) {
 	var assignment Circuit
 
-	alpha := big.NewInt(12345678)
-	kzgSRS, err := kzg.NewSRS(InputSize, alpha)
+	kzgSRS, err := kzg.LoadOrGenKey(*srsPath)
 	if err != nil {
 		return nil, err
 	}
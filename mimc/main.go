@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 
 	"github.com/consensys/gnark/backend/groth16"
@@ -9,6 +10,8 @@ import (
 )
 
 func main() {
+	flag.Parse()
+
 	witness, err := GenWithness()
 	if err != nil {
 		fmt.Printf("create witness fail: %s\n", err)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"math/big"
 
@@ -11,17 +12,18 @@ import (
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
 	"github.com/consensys/gnark/std/algebra/native/sw_bls12377"
-	"github.com/consensys/gnark/std/hash"
 	"github.com/consensys/gnark/std/hash/mimc"
+	"github.com/yydfjt/gnark-example/lib/merklecircuit"
 )
 
 var curveID = ecc.BW6_761
 
 const (
-	DepthC1          = 10
 	ChallengeCountC1 = 16
 )
 
+var depthC1 = flag.Int("depth", 10, "maximum depth of the Merkle tree")
+
 func init() {
 	solver.RegisterHint(ModHint)
 }
@@ -33,58 +35,33 @@ func ModHint(_ *big.Int, inputs []*big.Int, results []*big.Int) error {
 	return nil
 }
 
-type MerkleC1 struct {
-	Leaf frontend.Variable
-	Path [DepthC1 + 1]frontend.Variable
-}
-
-func leafSum(api frontend.API, h hash.FieldHasher, data frontend.Variable) frontend.Variable {
-	h.Reset()
-	h.Write(data)
-	res := h.Sum()
-	return res
-}
-
-func nodeSum(api frontend.API, h hash.FieldHasher, a, b frontend.Variable) frontend.Variable {
-	h.Reset()
-	h.Write(a, b)
-	res := h.Sum()
-	return res
-}
-
-func (mc1 *MerkleC1) VerifyProof(api frontend.API, h hash.FieldHasher, root frontend.Variable) {
-	sum := leafSum(api, h, mc1.Path[0])
-
-	binLeaf := api.ToBinary(mc1.Leaf, DepthC1)
-	for i := 1; i < DepthC1; i++ { // the size of the loop is fixed -> one circuit per size
-		d1 := api.Select(binLeaf[i-1], mc1.Path[i], sum)
-		d2 := api.Select(binLeaf[i-1], sum, mc1.Path[i])
-		update := nodeSum(api, h, d1, d2)
-		isZero := api.IsZero(mc1.Path[i])
-		sum = api.Select(isZero, sum, update) // for fixed depth
-	}
-
-	// Compare our calculated Merkle root to the desired Merkle root.
-	api.AssertIsEqual(sum, root)
-}
-
 type VK struct {
 	G1 sw_bls12377.G1Affine    // G₁
 	G2 [2]sw_bls12377.G2Affine // [G₂, [α]G₂]
 }
 
 type C1 struct {
-	MerkleProof  [ChallengeCountC1]MerkleC1
+	MerkleProof  [ChallengeCountC1]merklecircuit.VarDepthCircuit
 	CommitRoot   sw_bls12377.G1Affine                   `gnark:",public"`
 	RecoveryRoot sw_bls12377.G1Affine                   `gnark:",public"`
 	MerkleRoot   frontend.Variable                      `gnark:",public"`
 	Offset       frontend.Variable                      `gnark:",public"`
 	Max          frontend.Variable                      `gnark:",public"`
+	Depth        frontend.Variable                      `gnark:",public"`
 	VK           VK                                     `gnark:",public"`
 	VKG2         [ChallengeCountC1]sw_bls12377.G2Affine `gnark:",public"`
 	VKGT         sw_bls12377.GT                         `gnark:",public"`
 }
 
+// NewC1 allocates the Merkle paths for trees of up to maxDepth levels.
+func NewC1(maxDepth int) C1 {
+	var c C1
+	for i := range c.MerkleProof {
+		c.MerkleProof[i] = merklecircuit.NewVarDepth(maxDepth)
+	}
+	return c
+}
+
 func (c *C1) Define(api frontend.API) error {
 	h, err := mimc.NewMiMC(api)
 	if err != nil {
@@ -106,6 +83,8 @@ func (c *C1) Define(api frontend.API) error {
 
 		// verify merkle leaf
 		api.AssertIsEqual(c.MerkleProof[i].Leaf, choosed)
+		api.AssertIsEqual(c.MerkleProof[i].NumLeaves, c.Max)
+		api.AssertIsEqual(c.MerkleProof[i].Depth, c.Depth)
 		// verify merkle proof
 		c.MerkleProof[i].VerifyProof(api, &h, c.MerkleRoot)
 		// verify value is same
@@ -121,7 +100,7 @@ func (c *C1) Define(api frontend.API) error {
 }
 
 func GenC1() (witness.Witness, error) {
-	var assignment C1
+	assignment := NewC1(*depthC1)
 
 	witness, err := frontend.NewWitness(&assignment, curveID.ScalarField())
 	if err != nil {
@@ -165,12 +144,14 @@ func Run(circuit frontend.Circuit, w witness.Witness) error {
 }
 
 func main() {
+	flag.Parse()
+
 	w, err := GenC1()
 	if err != nil {
 		return
 	}
 
-	var circuit C1
+	circuit := NewC1(*depthC1)
 	err = Run(&circuit, w)
 	if err != nil {
 		return